@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// connect connects to the bus at the address, that can also be
+// session or system, in peer mode it skips Hello since there's no bus
+// daemon on the other side but the service itself.
+func connect(address string, peer bool) (*dbus.Conn, error) {
+	var conn *dbus.Conn
+	var err error
+	switch address {
+	case "session":
+		conn, err = dbus.SessionBusPrivate()
+	case "system":
+		conn, err = dbus.SystemBusPrivate()
+	default:
+		conn, err = dbus.Dial(address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !peer {
+		if err = conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// addresses returns addresses of buses to introspect.
+func (j *job) addresses() []string {
+	if len(j.Address) != 0 {
+		return j.Address
+	}
+	if j.System {
+		return []string{"system"}
+	}
+	return []string{"session"}
+}
+
+// live reports whether the job introspects running services instead of reading files.
+func (j *job) live() bool {
+	return len(j.Dest) != 0 || len(j.Discover) != 0 || j.Peer
+}
+
+// introspect walks object trees of all destinations on all buses.
+//
+// When there're several buses destinations missing on some of them are skipped,
+// but each destination has to be found at least on one bus. Discovered
+// destinations that fail to introspect are reported and skipped.
+func (j *job) introspect(fn visitFunc) error {
+	addrs := j.addresses()
+	found := make(map[string]bool, len(j.Dest))
+	for _, addr := range addrs {
+		conn, err := connect(addr, j.Peer)
+		if err != nil {
+			return fmt.Errorf("%s: %s", addr, err)
+		}
+		in, err := j.newIntrospector(conn)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		err = j.introspectBus(conn, len(addrs) > 1, func(dest string, discovered bool) error {
+			found[dest] = true
+			contributed := map[string]bool{}
+			var ifaces []string
+			if err := in.walk(dest, func(dest string, path dbus.ObjectPath, node *introspect.Node) error {
+				for _, iface := range node.Interfaces {
+					if !contributed[iface.Name] {
+						contributed[iface.Name] = true
+						ifaces = append(ifaces, iface.Name)
+					}
+				}
+				return fn(dest, path, node)
+			}); err != nil {
+				if !discovered {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "warning: skipping %s\n", err)
+				return nil
+			}
+			if discovered {
+				fmt.Fprintf(os.Stderr, "discovered %s: %s\n", dest, strings.Join(ifaces, ", "))
+			}
+			return nil
+		})
+		conn.Close()
+		if err != nil {
+			if j.Peer || len(addrs) == 1 {
+				return err
+			}
+			return fmt.Errorf("%s: %s", addr, err)
+		}
+	}
+	for _, dest := range j.Dest {
+		if !found[dest] {
+			return fmt.Errorf("destination %s is not found on any bus", dest)
+		}
+	}
+	return nil
+}
+
+// introspectBus calls fn for every destination to introspect on the bus.
+func (j *job) introspectBus(conn *dbus.Conn, multi bool, fn func(dest string, discovered bool) error) error {
+	if j.Peer {
+		if len(j.Dest) == 0 {
+			return fn("", false) // peers don't route messages by destination
+		}
+		for _, dest := range j.Dest {
+			if err := fn(dest, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var names map[string]bool
+	if multi || len(j.Discover) != 0 {
+		var err error
+		if names, err = listNames(conn); err != nil {
+			return err
+		}
+	}
+	for _, dest := range j.Dest {
+		if multi && !names[dest] {
+			continue
+		}
+		if err := fn(dest, false); err != nil {
+			return err
+		}
+	}
+	for _, dest := range discover(names, j.Discover, j.Dest) {
+		if err := fn(dest, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discover returns sorted well-known names matching the patterns
+// skipping the explicitly given destinations.
+func discover(names map[string]bool, patterns, dests []string) []string {
+	if len(patterns) == 0 {
+		return nil
+	}
+	skip := make(map[string]bool, len(dests))
+	for _, dest := range dests {
+		skip[dest] = true
+	}
+	compiled := compilePatterns(patterns, '.')
+	var found []string
+	for name := range names {
+		if !strings.HasPrefix(name, ":") && !skip[name] && matchAny(compiled, name) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// listNames returns all names on the bus, including activatable ones.
+func listNames(conn *dbus.Conn) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, method := range []string{
+		"org.freedesktop.DBus.ListNames",
+		"org.freedesktop.DBus.ListActivatableNames",
+	} {
+		var ss []string
+		if err := conn.BusObject().Call(method, 0).Store(&ss); err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			names[s] = true
+		}
+	}
+	return names, nil
+}
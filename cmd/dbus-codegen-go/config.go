@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/tq-systems/go-dbus-codegen/printer"
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// config is the -config file format, paths in it are relative to the file.
+type config struct {
+	Packages []*pkgConfig `json:"packages"`
+}
+
+// pkgConfig is a package generation entry, its fields mirror command-line flags.
+type pkgConfig struct {
+	Package       string                  `json:"package"`
+	Inputs        []string                `json:"inputs"`
+	Dest          []string                `json:"dest"`
+	Discover      []string                `json:"discover"`
+	Bus           string                  `json:"bus"`
+	Address       []string                `json:"address"`
+	Peer          bool                    `json:"peer"`
+	Paths         []string                `json:"paths"`
+	Depth         *int                    `json:"depth"`
+	PathOnly      []string                `json:"path_only"`
+	PathExcept    []string                `json:"path_except"`
+	SkipErrors    bool                    `json:"skip_errors"`
+	ObjectManager bool                    `json:"object_manager"`
+	Parallel      *int                    `json:"parallel"`
+	Timeout       string                  `json:"timeout"`
+	Progress      bool                    `json:"progress"`
+	Output        string                  `json:"output"`
+	Out           string                  `json:"out"`
+	Mock          bool                    `json:"mock"`
+	Runtime       bool                    `json:"runtime"`
+	Files         bool                    `json:"files"`
+	Standard      string                  `json:"standard"`
+	Features      []string                `json:"features"`
+	Only          []string                `json:"only"`
+	Except        []string                `json:"except"`
+	OnlyMembers   []string                `json:"only_members"`
+	ExceptMembers []string                `json:"except_members"`
+	Prefix        []string                `json:"prefix"`
+	Rename        []string                `json:"rename"`
+	Naming        string                  `json:"naming"`
+	Initialisms   *[]string               `json:"initialisms"`
+	Gofmt         *bool                   `json:"gofmt"`
+	Interfaces    map[string]*ifaceConfig `json:"interfaces"`
+	Enums         map[string]*enumConfig  `json:"enums"`
+}
+
+// enumConfig declares an enum or a flag set, keys of Values
+// are value names that are appended to the enum name.
+type enumConfig struct {
+	Flags  bool             `json:"flags"`
+	Type   string           `json:"type"`
+	Values map[string]int64 `json:"values"`
+}
+
+// ifaceConfig contains per-interface settings.
+type ifaceConfig struct {
+	// Name overrides the generated type name.
+	Name string `json:"name"`
+
+	// Types overrides Go types of properties and arguments,
+	// keys are property names or member names with argument names
+	// or their positions in the generated code like in0, out1 or v0
+	// separated by a dot, values are types that generated
+	// package declares or built-in and dbus types.
+	Types map[string]string `json:"types"`
+
+	// Refs declares interfaces of objects that o and ao properties
+	// and arguments refer to, keys are the same as of Types,
+	// values are D-Bus interface names.
+	Refs map[string]string `json:"refs"`
+
+	// Enums makes properties and arguments of enums declared
+	// in the package's enums, keys are the same as of Types,
+	// values are enum names.
+	Enums map[string]string `json:"enums"`
+
+	// Path is the object path of the interface or a template of
+	// object paths with {name} or {name:escape} placeholders,
+	// it overrides paths found by introspection.
+	Path string `json:"path"`
+}
+
+// loadConfig reads the config file and converts it into jobs.
+func loadConfig(filename string) ([]*job, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if len(cfg.Packages) == 0 {
+		return nil, fmt.Errorf("%s: no packages configured", filename)
+	}
+
+	dir := filepath.Dir(filename)
+	jobs := make([]*job, len(cfg.Packages))
+	outs := map[string]int{} // by directory and mock suffix
+	for i, pkg := range cfg.Packages {
+		if jobs[i], err = pkg.job(dir); err != nil {
+			return nil, fmt.Errorf("%s: packages[%d]: %s", filename, i, err)
+		}
+		if jobs[i].Out == "" {
+			continue
+		}
+		// files of one package in the directory are removed by the other
+		key := fmt.Sprintf("%s mock=%t", filepath.Clean(jobs[i].Out), jobs[i].Mock)
+		if n, ok := outs[key]; ok {
+			return nil, fmt.Errorf("%s: packages[%d]: out directory is used by packages[%d]", filename, i, n)
+		}
+		outs[key] = i
+	}
+	return jobs, nil
+}
+
+func (c *pkgConfig) job(dir string) (*job, error) {
+	if c.Package == "" {
+		return nil, errors.New("package is required")
+	}
+	if c.Output == "" && c.Out == "" {
+		return nil, errors.New("output or out is required")
+	}
+	live := len(c.Dest) != 0 || len(c.Discover) != 0 || c.Peer
+	if len(c.Inputs) == 0 && !live && c.Standard != "only" {
+		return nil, errors.New("inputs, dest, discover or peer is required")
+	}
+	if len(c.Inputs) != 0 && live {
+		return nil, errors.New("cannot combine inputs with dest, discover or peer")
+	}
+	if c.Peer && len(c.Discover) != 0 {
+		return nil, errors.New("cannot combine peer and discover")
+	}
+	if c.Peer && len(c.Address) == 0 {
+		return nil, errors.New("peer cannot be used without address")
+	}
+	j := &job{
+		Package:       c.Package,
+		Inputs:        make([]string, len(c.Inputs)),
+		Dest:          c.Dest,
+		Discover:      c.Discover,
+		Address:       c.Address,
+		Peer:          c.Peer,
+		Paths:         c.Paths,
+		Depth:         -1,
+		PathOnly:      c.PathOnly,
+		PathExcept:    c.PathExcept,
+		SkipErrors:    c.SkipErrors,
+		ObjectManager: c.ObjectManager,
+		Parallel:      defaultParallel,
+		Timeout:       defaultTimeout,
+		Progress:      c.Progress,
+		Output:        relPath(dir, c.Output),
+		Out:           relPath(dir, c.Out),
+		Mock:          c.Mock,
+		Runtime:       c.Runtime,
+		Files:         c.Files,
+		Standard:      c.Standard,
+		Features:      c.Features,
+		Only:          c.Only,
+		Except:        c.Except,
+		OnlyMembers:   c.OnlyMembers,
+		ExceptMembers: c.ExceptMembers,
+		Prefix:        c.Prefix,
+		Naming:        c.Naming,
+		Initialisms:   printer.DefaultInitialisms,
+		Gofmt:         true,
+		Interfaces:    c.Interfaces,
+	}
+	for i := range c.Inputs {
+		j.Inputs[i] = relPath(dir, c.Inputs[i])
+	}
+	switch c.Bus {
+	case "", "session":
+	case "system":
+		j.System = true
+	default:
+		return nil, fmt.Errorf("unknown bus %q", c.Bus)
+	}
+	for _, s := range c.Rename {
+		r, err := printer.ParseRenameRule(s)
+		if err != nil {
+			return nil, err
+		}
+		j.Rename = append(j.Rename, r)
+	}
+	if c.Initialisms != nil {
+		j.Initialisms = *c.Initialisms
+	}
+	if c.Depth != nil {
+		j.Depth = *c.Depth
+	}
+	if c.Parallel != nil {
+		j.Parallel = *c.Parallel
+	}
+	if c.Timeout != "" {
+		var err error
+		if j.Timeout, err = time.ParseDuration(c.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %s", err)
+		}
+	}
+	if c.Gofmt != nil {
+		j.Gofmt = *c.Gofmt
+	}
+	for name, e := range c.Enums {
+		enum := &token.Enum{Name: name, Type: e.Type, Flags: e.Flags}
+		for v, n := range e.Values {
+			enum.Values = append(enum.Values, &token.EnumValue{Name: v, Value: n})
+		}
+		sort.Slice(enum.Values, func(i, j int) bool {
+			a, b := enum.Values[i], enum.Values[j]
+			return a.Value < b.Value || a.Value == b.Value && a.Name < b.Name
+		})
+		j.Enums = append(j.Enums, enum)
+	}
+	sort.Slice(j.Enums, func(a, b int) bool {
+		return j.Enums[a].Name < j.Enums[b].Name
+	})
+	return j, nil
+}
+
+func relPath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// applyInterfaces applies per-interface settings to ifaces
+// and returns rename rules that implement type name overrides,
+// enums are the ones that settings may refer to.
+func (j *job) applyInterfaces(ifaces []*token.Interface, enums []*token.Enum) ([]*printer.RenameRule, error) {
+	var rules []*printer.RenameRule
+	for _, iface := range ifaces {
+		c, ok := j.Interfaces[iface.Name]
+		if !ok {
+			continue
+		}
+		if c.Name != "" {
+			rules = append(rules, &printer.RenameRule{
+				Scope:   printer.RenameInterface,
+				Pattern: regexp.MustCompile("^" + regexp.QuoteMeta(iface.Name) + "$"),
+				Replace: c.Name,
+			})
+		}
+		for key, typ := range c.Types {
+			arg := lookupArg(iface, key)
+			if arg == nil {
+				return nil, fmt.Errorf("%s: no property or argument matches %q", iface.Name, key)
+			}
+			arg.Type = typ
+		}
+		for key, ref := range c.Refs {
+			arg := lookupArg(iface, key)
+			if arg == nil {
+				return nil, fmt.Errorf("%s: no property or argument matches %q", iface.Name, key)
+			}
+			arg.Ref = ref
+		}
+		for key, name := range c.Enums {
+			arg := lookupArg(iface, key)
+			if arg == nil {
+				return nil, fmt.Errorf("%s: no property or argument matches %q", iface.Name, key)
+			}
+			enum := lookupEnum(enums, name)
+			if enum == nil {
+				return nil, fmt.Errorf("%s: unknown enum %q", iface.Name, name)
+			}
+			if err := enum.Apply(arg); err != nil {
+				return nil, fmt.Errorf("%s: %s", iface.Name, err)
+			}
+		}
+		switch {
+		case c.Path == "":
+		case strings.ContainsRune(c.Path, '{'):
+			iface.PathTemplate = c.Path
+		case dbus.ObjectPath(c.Path).IsValid():
+			iface.Paths = []string{c.Path}
+			iface.PathTemplate = ""
+		default:
+			return nil, fmt.Errorf("%s: invalid object path %q", iface.Name, c.Path)
+		}
+	}
+	return rules, nil
+}
+
+// lookupEnum finds the named enum, nil if there's no one.
+func lookupEnum(enums []*token.Enum, name string) *token.Enum {
+	for _, enum := range enums {
+		if enum.Name == name {
+			return enum
+		}
+	}
+	return nil
+}
+
+// lookupArg finds the property or argument addressed by the key,
+// see ifaceConfig.Types for its format.
+func lookupArg(iface *token.Interface, key string) *token.Arg {
+	i := strings.IndexByte(key, '.')
+	if i == -1 {
+		for _, prop := range iface.Properties {
+			if prop.Name == key {
+				return prop.Arg
+			}
+		}
+		return nil
+	}
+	member, name := key[:i], key[i+1:]
+	for _, method := range iface.Methods {
+		if method.Name == member {
+			return method.Arg(name)
+		}
+	}
+	for _, signal := range iface.Signals {
+		if signal.Name == member {
+			return signal.Arg(name)
+		}
+	}
+	return nil
+}
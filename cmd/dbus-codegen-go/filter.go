@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// pattern matches D-Bus names or object paths, * matches any part of a single
+// name element and ** any number of elements, so org.bluez.** matches
+// all bluez interfaces and /org/bluez/** all objects under /org/bluez.
+type pattern struct {
+	src string
+	re  *regexp.Regexp
+}
+
+// compilePattern compiles s with elements separated by sep.
+func compilePattern(s string, sep byte) *pattern {
+	var buf strings.Builder
+	buf.WriteByte('^')
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case s[i] == '*':
+			buf.WriteString("[^" + regexp.QuoteMeta(string(sep)) + "]*")
+		default:
+			buf.WriteString(regexp.QuoteMeta(s[i : i+1]))
+		}
+	}
+	buf.WriteByte('$')
+	return &pattern{src: s, re: regexp.MustCompile(buf.String())}
+}
+
+func (p *pattern) match(name string) bool {
+	return p.re.MatchString(name)
+}
+
+func compilePatterns(ss []string, sep byte) []*pattern {
+	patterns := make([]*pattern, len(ss))
+	for i, s := range ss {
+		patterns[i] = compilePattern(s, sep)
+	}
+	return patterns
+}
+
+func matchAny(patterns []*pattern, s string) bool {
+	for _, p := range patterns {
+		if p.match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterInterfaces filters ifaces by -only or -except patterns,
+// reporting patterns that match no interfaces.
+func filterInterfaces(ifaces []*token.Interface, only, except []string) []*token.Interface {
+	if len(only) == 0 && len(except) == 0 {
+		return ifaces
+	}
+	flagName, ss := "only", only
+	if len(except) != 0 {
+		flagName, ss = "except", except
+	}
+	patterns := compilePatterns(ss, '.')
+	matched := make([]bool, len(patterns))
+	filtered := make([]*token.Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		var found bool
+		for i, p := range patterns {
+			if p.match(iface.Name) {
+				matched[i] = true
+				found = true
+			}
+		}
+		if found == (len(only) != 0) {
+			filtered = append(filtered, iface)
+		}
+	}
+	for i, ok := range matched {
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: -%s pattern %q matches no interfaces\n", flagName, patterns[i].src)
+		}
+	}
+	return filtered
+}
+
+// memberPattern matches interface members in [KIND:]IFACE.MEMBER format,
+// where KIND is method, property or signal, it matches all kinds when omitted.
+type memberPattern struct {
+	src    string
+	kind   string
+	iface  *pattern
+	member *pattern
+}
+
+func parseMemberPattern(s string) (*memberPattern, error) {
+	p := &memberPattern{src: s}
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		p.kind, s = s[:i], s[i+1:]
+		switch p.kind {
+		case "method", "property", "signal":
+		default:
+			return nil, fmt.Errorf("member pattern %q has unknown kind %q", p.src, p.kind)
+		}
+	}
+	i := strings.LastIndexByte(s, '.')
+	if i == -1 {
+		return nil, fmt.Errorf("member pattern %q is not in [KIND:]IFACE.MEMBER format", p.src)
+	}
+	p.iface, p.member = compilePattern(s[:i], '.'), compilePattern(s[i+1:], '.')
+	return p, nil
+}
+
+func parseMemberPatterns(ss []string) ([]*memberPattern, error) {
+	patterns := make([]*memberPattern, len(ss))
+	for i, s := range ss {
+		var err error
+		if patterns[i], err = parseMemberPattern(s); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+// memberFilter drops members of interfaces according to patterns.
+type memberFilter struct {
+	only    []*memberPattern
+	except  []*memberPattern
+	matched map[*memberPattern]bool
+}
+
+// filterMembers removes members not matching -only-members patterns
+// from interfaces addressed by them and members matching -except-members
+// patterns, reporting patterns that match no members.
+func filterMembers(ifaces []*token.Interface, only, except []string) error {
+	if len(only) == 0 && len(except) == 0 {
+		return nil
+	}
+	f := &memberFilter{matched: map[*memberPattern]bool{}}
+	var err error
+	if f.only, err = parseMemberPatterns(only); err != nil {
+		return err
+	}
+	if f.except, err = parseMemberPatterns(except); err != nil {
+		return err
+	}
+	for _, iface := range ifaces {
+		f.filter(iface)
+	}
+	f.warn("only-members", f.only)
+	f.warn("except-members", f.except)
+	return nil
+}
+
+func (f *memberFilter) filter(iface *token.Interface) {
+	// only interfaces addressed by -only-members patterns are narrowed down
+	var only []*memberPattern
+	for _, p := range f.only {
+		if p.iface.match(iface.Name) {
+			only = append(only, p)
+		}
+	}
+
+	methods := iface.Methods[:0]
+	for _, method := range iface.Methods {
+		if f.keep(only, iface, "method", method.Name) {
+			methods = append(methods, method)
+		}
+	}
+	iface.Methods = methods
+
+	props := iface.Properties[:0]
+	for _, prop := range iface.Properties {
+		if f.keep(only, iface, "property", prop.Name) {
+			props = append(props, prop)
+		}
+	}
+	iface.Properties = props
+
+	signals := iface.Signals[:0]
+	for _, signal := range iface.Signals {
+		if f.keep(only, iface, "signal", signal.Name) {
+			signals = append(signals, signal)
+		}
+	}
+	iface.Signals = signals
+}
+
+func (f *memberFilter) keep(only []*memberPattern, iface *token.Interface, kind, name string) bool {
+	keep := len(only) == 0
+	for _, p := range only {
+		if f.match(p, iface, kind, name) {
+			keep = true
+		}
+	}
+	for _, p := range f.except {
+		if f.match(p, iface, kind, name) {
+			keep = false
+		}
+	}
+	return keep
+}
+
+func (f *memberFilter) match(p *memberPattern, iface *token.Interface, kind, name string) bool {
+	if (p.kind == "" || p.kind == kind) && p.iface.match(iface.Name) && p.member.match(name) {
+		f.matched[p] = true
+		return true
+	}
+	return false
+}
+
+func (f *memberFilter) warn(flagName string, patterns []*memberPattern) {
+	for _, p := range patterns {
+		if !f.matched[p] {
+			fmt.Fprintf(os.Stderr, "warning: -%s pattern %q matches no members\n", flagName, p.src)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// Defaults of -parallel and -timeout flags.
+const (
+	defaultParallel = 16
+	defaultTimeout  = 30 * time.Second
+)
+
+// introspector walks object trees of destinations.
+type introspector struct {
+	conn     *dbus.Conn
+	roots    []dbus.ObjectPath
+	depth    int // maximum depth below roots, negative is unlimited
+	only     []*pattern
+	except   []*pattern
+	skip     bool // skip and report failing children instead of failing
+	managed  bool // enumerate objects with GetManagedObjects when possible
+	timeout  time.Duration
+	progress bool
+
+	sem     chan struct{} // limits concurrent Introspect calls
+	workers chan struct{} // limits goroutines walking the tree
+	count   int64         // number of objects introspected by the current walk
+
+	mu    sync.Mutex
+	err   error                       // error failing the current walk
+	cache map[string]*introspect.Node // parsed documents by their contents
+}
+
+func (j *job) newIntrospector(conn *dbus.Conn) (*introspector, error) {
+	if j.Parallel < 1 {
+		return nil, fmt.Errorf("invalid -parallel value %d", j.Parallel)
+	}
+	in := &introspector{
+		conn:     conn,
+		depth:    j.Depth,
+		only:     compilePatterns(j.PathOnly, '/'),
+		except:   compilePatterns(j.PathExcept, '/'),
+		skip:     j.SkipErrors,
+		managed:  j.ObjectManager,
+		timeout:  j.Timeout,
+		progress: j.Progress,
+		sem:      make(chan struct{}, j.Parallel),
+		workers:  make(chan struct{}, j.Parallel),
+		cache:    map[string]*introspect.Node{},
+	}
+	if len(j.Paths) == 0 {
+		in.roots = []dbus.ObjectPath{"/"}
+	}
+	for _, s := range j.Paths {
+		path := dbus.ObjectPath(s)
+		if !path.IsValid() {
+			return nil, fmt.Errorf("invalid object path %q", s)
+		}
+		in.roots = append(in.roots, path)
+	}
+	return in, nil
+}
+
+// object is an introspected object with its subtree.
+type object struct {
+	path     dbus.ObjectPath
+	node     *introspect.Node
+	err      error
+	children []*object
+}
+
+// visitFunc is called for every introspected object, objects with
+// identical introspection documents share the same node.
+type visitFunc func(dest string, path dbus.ObjectPath, node *introspect.Node) error
+
+// walk introspects objects of dest concurrently and then calls fn
+// in depth-first order for objects that pass path filters,
+// so results are deterministic. Subtrees of excluded paths
+// are not introspected.
+func (in *introspector) walk(dest string, fn visitFunc) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in.err = nil
+	atomic.StoreInt64(&in.count, 0)
+	if in.progress {
+		defer in.report(dest)()
+	}
+
+	objs := make([]*object, len(in.roots))
+	var wg sync.WaitGroup
+	for i := range in.roots {
+		i := i
+		in.spawn(&wg, func() {
+			if in.managed {
+				if objs[i] = in.walkManaged(ctx, cancel, dest, in.roots[i]); objs[i] != nil {
+					return
+				}
+			}
+			objs[i] = in.walkPath(ctx, cancel, dest, in.roots[i], 0)
+		})
+	}
+	wg.Wait()
+	if in.err != nil {
+		return in.err
+	}
+	for _, obj := range objs {
+		if err := in.visit(dest, obj, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *introspector) walkPath(
+	ctx context.Context, cancel context.CancelFunc,
+	dest string, path dbus.ObjectPath, depth int,
+) *object {
+	if matchAny(in.except, string(path)) {
+		return nil
+	}
+	obj := &object{path: path}
+	obj.node, obj.err = in.introspect(ctx, dest, path)
+	if obj.err != nil {
+		if depth == 0 || !in.skip {
+			in.fail(fmt.Errorf("%s %s: %s", dest, path, obj.err))
+			cancel() // no need to go on when the run fails anyway
+		}
+		return obj
+	}
+	if in.depth >= 0 && depth >= in.depth {
+		return obj
+	}
+
+	obj.children = make([]*object, len(obj.node.Children))
+	prefix := strings.TrimSuffix(string(path), "/")
+	var wg sync.WaitGroup
+	for i, child := range obj.node.Children {
+		i, path := i, dbus.ObjectPath(prefix+"/"+child.Name)
+		in.spawn(&wg, func() {
+			obj.children[i] = in.walkPath(ctx, cancel, dest, path, depth+1)
+		})
+	}
+	wg.Wait()
+	return obj
+}
+
+// spawn runs fn in a new goroutine when there're fewer than -parallel
+// walking ones and in the current goroutine otherwise,
+// so huge trees don't start a goroutine per object.
+func (in *introspector) spawn(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	select {
+	case in.workers <- struct{}{}:
+		go func() {
+			defer wg.Done()
+			defer func() { <-in.workers }()
+			fn()
+		}()
+	default:
+		defer wg.Done()
+		fn()
+	}
+}
+
+// visit calls fn for obj and its subtree in depth-first order.
+func (in *introspector) visit(dest string, obj *object, fn visitFunc) error {
+	if obj == nil {
+		return nil
+	}
+	if obj.err != nil {
+		fmt.Fprintf(os.Stderr, "warning: skipping %s %s: %s\n", dest, obj.path, obj.err)
+		return nil
+	}
+	if len(in.only) == 0 || matchAny(in.only, string(obj.path)) {
+		if err := fn(dest, obj.path, obj.node); err != nil {
+			return err
+		}
+	}
+	for _, child := range obj.children {
+		if err := in.visit(dest, child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail records the error that fails the walk, only the first one is kept.
+func (in *introspector) fail(err error) {
+	in.mu.Lock()
+	if in.err == nil {
+		in.err = err
+	}
+	in.mu.Unlock()
+}
+
+// introspect introspects the object, identical documents
+// are parsed only once and share the same node.
+func (in *introspector) introspect(ctx context.Context, dest string, path dbus.ObjectPath) (*introspect.Node, error) {
+	var s string
+	if err := in.call(ctx, dest, path, "org.freedesktop.DBus.Introspectable.Introspect", &s); err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&in.count, 1)
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if node, ok := in.cache[s]; ok {
+		return node, nil
+	}
+	var node introspect.Node
+	if err := xml.Unmarshal([]byte(s), &node); err != nil {
+		return nil, err
+	}
+	in.cache[s] = &node
+	return &node, nil
+}
+
+// call calls the method without arguments respecting
+// the concurrency limit and the timeout, and stores its result to v.
+func (in *introspector) call(ctx context.Context, dest string, path dbus.ObjectPath, method string, v interface{}) error {
+	select {
+	case in.sem <- struct{}{}:
+		defer func() { <-in.sem }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if in.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, in.timeout)
+		defer cancel()
+	}
+	return in.conn.Object(dest, path).CallWithContext(ctx, method, 0).Store(v)
+}
+
+// report prints the number of introspected objects every second
+// until the returned function is called.
+func (in *introspector) report(dest string) func() {
+	start := time.Now()
+	in.mu.Lock()
+	docs := len(in.cache)
+	in.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(os.Stderr, "%s: %d objects introspected\n", dest, atomic.LoadInt64(&in.count))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		in.mu.Lock()
+		docs = len(in.cache) - docs
+		in.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "%s: %d objects introspected, %d new unique documents, took %s\n",
+			dest, atomic.LoadInt64(&in.count), docs, time.Since(start).Round(time.Millisecond))
+	}
+}
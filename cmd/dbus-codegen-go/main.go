@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
@@ -17,14 +22,42 @@ import (
 )
 
 var (
-	destFlag     []string
-	onlyFlag     []string
-	exceptFlag   []string
-	prefixesFlag []string
-	systemFlag   bool
-	packageFlag  string
-	gofmtFlag    bool
-	xmlFlag      bool
+	destFlag      []string
+	discoverFlag  []string
+	onlyFlag      []string
+	exceptFlag    []string
+	onlyMembers   []string
+	exceptMembers []string
+	prefixesFlag  []string
+	systemFlag    bool
+	addressFlag   []string
+	peerFlag      bool
+	packageFlag   string
+	gofmtFlag     bool
+	xmlFlag       bool
+	xmlTreeFlag   bool
+	xmlCollapse   bool
+	mockFlag      bool
+	runtimeFlag   bool
+	filesFlag     bool
+	standardFlag  string
+	featuresFlag  []string
+	namingFlag    string
+	initialsFlag  string
+	renameFlag    []*printer.RenameRule
+	outFlag       string
+	outputFlag    string
+	checkFlag     bool
+	configFlag    string
+	pathsFlag     []string
+	depthFlag     int
+	pathOnly      []string
+	pathExcept    []string
+	skipErrors    bool
+	objectManager bool
+	parallelFlag  int
+	timeoutFlag   time.Duration
+	progressFlag  bool
 )
 
 type stringsFlag []string
@@ -43,6 +76,38 @@ func (ss *stringsFlag) Set(arg string) error {
 	return nil
 }
 
+// listFlag collects values of a repeated flag as is,
+// for values that may contain commas like bus addresses.
+type listFlag []string
+
+func (ls *listFlag) String() string {
+	return "[" + strings.Join(*ls, ", ") + "]"
+}
+
+func (ls *listFlag) Set(arg string) error {
+	*ls = append(*ls, arg)
+	return nil
+}
+
+type rulesFlag []*printer.RenameRule
+
+func (rs *rulesFlag) String() string {
+	ss := make([]string, len(*rs))
+	for i, r := range *rs {
+		ss[i] = r.String()
+	}
+	return "[" + strings.Join(ss, ", ") + "]"
+}
+
+func (rs *rulesFlag) Set(arg string) error {
+	r, err := printer.ParseRenameRule(arg)
+	if err != nil {
+		return err
+	}
+	*rs = append(*rs, r)
+	return nil
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Usage: %s [FLAG...] [PATH...]
@@ -54,13 +119,42 @@ Flags:
 		flag.PrintDefaults()
 	}
 	flag.Var((*stringsFlag)(&destFlag), "dest", "destination name(s) to introspect")
-	flag.Var((*stringsFlag)(&onlyFlag), "only", "generate code only for the named interfaces")
-	flag.Var((*stringsFlag)(&exceptFlag), "except", "skip the named interfaces")
+	flag.Var((*stringsFlag)(&discoverFlag), "discover", "introspect all names on the bus matching the pattern(s), like org.freedesktop.*")
+	flag.Var((*stringsFlag)(&onlyFlag), "only", "generate code only for interfaces matching the pattern(s), * matches a name element, ** any number of them")
+	flag.Var((*stringsFlag)(&exceptFlag), "except", "skip interfaces matching the pattern(s)")
+	flag.Var((*stringsFlag)(&onlyMembers), "only-members", "generate only members matching the pattern(s) in [KIND:]IFACE.MEMBER format of interfaces they address, KIND is method, property or signal")
+	flag.Var((*stringsFlag)(&exceptMembers), "except-members", "skip members matching the pattern(s) in [KIND:]IFACE.MEMBER format")
 	flag.Var((*stringsFlag)(&prefixesFlag), "prefix", "prefix to strip from interface names")
+	flag.Var((*rulesFlag)(&renameFlag), "rename", "rename rule in SCOPE:PATTERN=REPLACE format, where SCOPE is iface, method, property, signal or arg")
+	flag.Var((*stringsFlag)(&pathsFlag), "path", "object path(s) to start introspection of -dest from, / by default")
+	flag.IntVar(&depthFlag, "depth", -1, "maximum depth of introspected objects below -path, negative is unlimited")
+	flag.Var((*stringsFlag)(&pathOnly), "path-only", "use interfaces only of objects matching the path pattern(s), * matches a path element, ** any number of them")
+	flag.Var((*stringsFlag)(&pathExcept), "path-except", "skip objects matching the path pattern(s) along with their children")
+	flag.BoolVar(&skipErrors, "skip-errors", false, "skip and report objects that fail to introspect instead of failing")
+	flag.BoolVar(&objectManager, "object-manager", false, "enumerate objects of -dest with GetManagedObjects when it implements org.freedesktop.DBus.ObjectManager and introspect one object per interface set")
+	flag.IntVar(&parallelFlag, "parallel", defaultParallel, "maximum number of concurrent Introspect calls")
+	flag.DurationVar(&timeoutFlag, "timeout", defaultTimeout, "timeout of a single Introspect call, zero disables it")
+	flag.BoolVar(&progressFlag, "progress", false, "report introspection progress to stderr")
 	flag.BoolVar(&systemFlag, "system", false, "connect to the system bus")
+	flag.Var((*listFlag)(&addressFlag), "address", "address of the bus to connect to instead of the session bus, session or system, repeat to introspect several buses")
+	flag.BoolVar(&peerFlag, "peer", false, "connect to -address directly as a peer, without a bus daemon")
 	flag.StringVar(&packageFlag, "package", "dbusgen", "generated package name")
 	flag.BoolVar(&gofmtFlag, "gofmt", true, "gofmt results")
 	flag.BoolVar(&xmlFlag, "xml", false, "combine the dest's introspections into a single document")
+	flag.BoolVar(&xmlTreeFlag, "xml-tree", false, "like -xml but keep the object tree, one document per destination")
+	flag.BoolVar(&xmlCollapse, "xml-collapse", false, "like -xml-tree but collapse identical sibling objects into templates")
+	flag.StringVar(&outFlag, "out", "", "write one file per interface into the directory instead of stdout")
+	flag.StringVar(&outputFlag, "o", "", "write the generated code to the file instead of stdout")
+	flag.BoolVar(&checkFlag, "check", false, "exit with an error if -o or -out files differ from generated code")
+	flag.StringVar(&configFlag, "config", "", "JSON file describing packages to generate, see README")
+	flag.BoolVar(&mockFlag, "mock", false, "generate in-memory mocks instead of client code")
+	flag.BoolVar(&runtimeFlag, "runtime", false, "import common types from the rt package and register interfaces and signals in it")
+	flag.BoolVar(&filesFlag, "files", false, "use *os.File for h arguments of methods and signals instead of dbus.UnixFD")
+	flag.StringVar(&standardFlag, "standard", "", "include, exclude or only generate standard interfaces shipped with the tool, any of them adds Ping, Introspect and GetProperties helpers to proxies")
+	flag.Var((*stringsFlag)(&featuresFlag), "features", "parts of code to generate: types, client, server, signals, properties (requires client) and mocks, client,signals,properties by default")
+	flag.StringVar(&namingFlag, "naming", "ugly", "naming style of generated types: ugly or camel")
+	flag.StringVar(&initialsFlag, "initialisms", strings.Join(printer.DefaultInitialisms, ","),
+		"comma-separated initialisms to upper-case in identifiers, empty to disable")
 	flag.Parse()
 
 	if err := run(); err != nil {
@@ -70,123 +164,371 @@ Flags:
 }
 
 func run() error {
-	var ifaces []*token.Interface
-	if len(destFlag) == 0 && xmlFlag {
-		return errors.New("flag -xml cannot be used without -dest flag")
-	}
-	if len(destFlag) != 0 {
+	if configFlag != "" {
 		if flag.NArg() > 0 {
-			return errors.New("cannot combine arguments and -dest flag")
+			return errors.New("cannot combine -config flag with arguments")
 		}
-		conn, err := connect(systemFlag)
+		// everything else is configured by the file
+		var other []string
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name != "config" && f.Name != "check" {
+				other = append(other, "-"+f.Name)
+			}
+		})
+		if len(other) != 0 {
+			return fmt.Errorf("cannot combine -config flag with %s", strings.Join(other, ", "))
+		}
+		jobs, err := loadConfig(configFlag)
 		if err != nil {
 			return err
 		}
-		defer conn.Close()
-
-		if xmlFlag {
-			b, err := generateXML(conn, destFlag)
-			if err != nil {
-				return err
+		for _, j := range jobs {
+			if err = j.run(); err != nil {
+				return fmt.Errorf("package %s: %s", j.Package, err)
 			}
-			fmt.Println(string(b))
-			return nil
 		}
-		ifaces, err = parseDest(conn, destFlag)
+		return nil
+	}
+	live := len(destFlag) != 0 || len(discoverFlag) != 0 || peerFlag
+	if !live && (xmlFlag || xmlTreeFlag || xmlCollapse) {
+		return errors.New("flag -xml cannot be used without -dest, -discover or -peer flag")
+	}
+	if live && flag.NArg() > 0 {
+		return errors.New("cannot combine arguments and -dest, -discover or -peer flag")
+	}
+	if peerFlag && len(discoverFlag) != 0 {
+		return errors.New("cannot combine -peer and -discover flags")
+	}
+	if peerFlag && len(addressFlag) == 0 {
+		return errors.New("flag -peer cannot be used without -address flag")
+	}
+	j := &job{
+		Package:       packageFlag,
+		Inputs:        flag.Args(),
+		Dest:          destFlag,
+		Discover:      discoverFlag,
+		System:        systemFlag,
+		Address:       addressFlag,
+		Peer:          peerFlag,
+		Paths:         pathsFlag,
+		Depth:         depthFlag,
+		PathOnly:      pathOnly,
+		PathExcept:    pathExcept,
+		SkipErrors:    skipErrors,
+		ObjectManager: objectManager,
+		Parallel:      parallelFlag,
+		Timeout:       timeoutFlag,
+		Progress:      progressFlag,
+		Output:        outputFlag,
+		Out:           outFlag,
+		Mock:          mockFlag,
+		Runtime:       runtimeFlag,
+		Files:         filesFlag,
+		Standard:      standardFlag,
+		Features:      featuresFlag,
+		Only:          onlyFlag,
+		Except:        exceptFlag,
+		OnlyMembers:   onlyMembers,
+		ExceptMembers: exceptMembers,
+		Prefix:        prefixesFlag,
+		Rename:        renameFlag,
+		Naming:        namingFlag,
+		Initialisms:   splitList(initialsFlag),
+		Gofmt:         gofmtFlag,
+	}
+	if xmlFlag || xmlTreeFlag || xmlCollapse {
+		return j.runXML(xmlTreeFlag || xmlCollapse, xmlCollapse)
+	}
+	return j.run()
+}
+
+// job is a single generation run producing one package,
+// configured either with flags or with an entry of the config file.
+type job struct {
+	Package       string
+	Inputs        []string
+	Dest          []string
+	Discover      []string
+	System        bool
+	Address       []string
+	Peer          bool
+	Paths         []string
+	Depth         int
+	PathOnly      []string
+	PathExcept    []string
+	SkipErrors    bool
+	ObjectManager bool
+	Parallel      int
+	Timeout       time.Duration
+	Progress      bool
+	Output        string
+	Out           string
+	Mock          bool
+	Runtime       bool
+	Files         bool
+	Standard      string
+	Features      []string
+	Only          []string
+	Except        []string
+	OnlyMembers   []string
+	ExceptMembers []string
+	Prefix        []string
+	Rename        []*printer.RenameRule
+	Naming        string
+	Initialisms   []string
+	Gofmt         bool
+	Interfaces    map[string]*ifaceConfig
+	Enums         []*token.Enum
+}
+
+func (j *job) run() error {
+	if j.Out != "" && j.Output != "" {
+		return errors.New("cannot combine -o and -out flags")
+	}
+	if checkFlag && j.Out == "" && j.Output == "" {
+		return errors.New("flag -check cannot be used without -o or -out flag")
+	}
+	if len(j.Only) != 0 && len(j.Except) != 0 {
+		return errors.New("cannot combine -only and -except flags")
+	}
+	features := printer.DefaultFeatures
+	if len(j.Features) != 0 {
+		var err error
+		if features, err = printer.ParseFeatures(j.Features); err != nil {
+			return err
+		}
+	}
+	var style printer.NamingStyle
+	switch j.Naming {
+	case "ugly", "":
+		style = printer.UglyCase
+	case "camel":
+		style = printer.CamelCase
+	default:
+		return fmt.Errorf("unknown naming style %q", j.Naming)
+	}
+
+	switch j.Standard {
+	case "", "include", "exclude":
+	case "only":
+		if j.live() || len(j.Inputs) != 0 {
+			return errors.New("cannot combine -standard=only with arguments, -dest, -discover or -peer flag")
+		}
+	default:
+		return fmt.Errorf("unknown -standard value %q", j.Standard)
+	}
+
+	var ifaces []*token.Interface
+	hash := sha256.New()
+	if j.live() {
+		var err error
+		ifaces, err = parseDest(j, hash)
 		if err != nil {
 			return err
 		}
-	} else if flag.NArg() > 0 {
-		for _, filename := range flag.Args() {
+	} else if len(j.Inputs) > 0 {
+		for _, filename := range j.Inputs {
 			b, err := ioutil.ReadFile(filename)
 			if err != nil {
 				return err
 			}
+			hash.Write(b)
 			chunk, err := parser.Parse(b)
 			if err != nil {
 				return err
 			}
 			ifaces = merge(ifaces, chunk)
 		}
-	} else {
+	} else if j.Standard != "only" {
 		b, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
 			return err
 		}
+		hash.Write(b)
 		ifaces, err = parser.Parse(b)
 		if err != nil {
 			return err
 		}
 	}
 
-	if len(onlyFlag) != 0 && len(exceptFlag) != 0 {
-		return errors.New("cannot combine -only and -except flags")
+	ifaces = j.applyStandard(ifaces, hash)
+	filtered := filterInterfaces(ifaces, j.Only, j.Except)
+	if err := filterMembers(filtered, j.OnlyMembers, j.ExceptMembers); err != nil {
+		return err
 	}
-	filtered := make([]*token.Interface, 0, len(ifaces))
+	// enums and types of filtered out interfaces are kept,
+	// arguments of other interfaces may be of them
+	enums := j.Enums
+	var types []*token.Type
 	for _, iface := range ifaces {
-		if len(onlyFlag) == 0 && len(exceptFlag) == 0 ||
-			len(onlyFlag) != 0 && includes(onlyFlag, iface.Name) ||
-			len(exceptFlag) != 0 && !includes(exceptFlag, iface.Name) {
-			filtered = append(filtered, iface)
-		}
+		enums = append(enums[:len(enums):len(enums)], iface.Enums...)
+		types = append(types, iface.Types...)
+	}
+	renames, err := j.applyInterfaces(filtered, enums)
+	if err != nil {
+		return err
 	}
-	return printer.Print(os.Stdout, filtered,
-		printer.WithPackageName(packageFlag),
-		printer.WithGofmt(gofmtFlag),
-		printer.WithPrefixes(prefixesFlag),
-	)
-}
 
-func connect(system bool) (*dbus.Conn, error) {
-	if system {
-		return dbus.SystemBus()
+	opts := []printer.PrintOption{
+		printer.WithPackageName(j.Package),
+		printer.WithGofmt(j.Gofmt),
+		printer.WithPrefixes(j.Prefix),
+		printer.WithNamingStyle(style),
+		printer.WithInitialisms(j.Initialisms),
+		printer.WithRenameRules(append(renames, j.Rename...)),
+		printer.WithRuntime(j.Runtime),
+		printer.WithFiles(j.Files),
+		printer.WithStandard(j.Standard != ""),
+		printer.WithFeatures(features),
+		printer.WithEnums(enums),
+		printer.WithTypes(types),
+		printer.WithInputHash(fmt.Sprintf("sha256:%x", hash.Sum(nil))),
+		printer.WithConflictReport(func(c printer.Conflict) {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", c)
+		}),
 	}
-	return dbus.SessionBus()
+	files := map[string][]byte{}
+	var extra []string
+	if j.Out != "" {
+		generate := printer.PrintFiles
+		if j.Mock {
+			generate = printer.PrintMockFiles
+		}
+		generated, err := generate(filtered, opts...)
+		if err != nil {
+			return err
+		}
+		for name, b := range generated {
+			files[filepath.Join(j.Out, name)] = b
+		}
+		if extra, err = extraFiles(j.Out, files, j.Mock, j.Package); err != nil {
+			return err
+		}
+	} else {
+		generate := printer.Print
+		if j.Mock {
+			generate = printer.PrintMocks
+		}
+		var buf bytes.Buffer
+		if err := generate(&buf, filtered, opts...); err != nil {
+			return err
+		}
+		if j.Output == "" {
+			_, err := os.Stdout.Write(buf.Bytes())
+			return err
+		}
+		files[j.Output] = buf.Bytes()
+	}
+	if checkFlag {
+		return checkFiles(files, extra)
+	}
+	return writeFiles(files, extra)
 }
 
-func parseDest(conn *dbus.Conn, dests []string) ([]*token.Interface, error) {
+// parseDest introspects the job's destinations and writes
+// their introspection documents to w for hashing.
+func parseDest(j *job, w io.Writer) ([]*token.Interface, error) {
 	ifaces := make([]*token.Interface, 0, 16)
-	for _, dest := range dests {
-		if err := introspectDest(conn, dest, "/", func(node *introspect.Node) error {
+	seen := map[*introspect.Node]bool{}
+	if err := j.introspect(func(dest string, path dbus.ObjectPath, node *introspect.Node) error {
+		if !seen[node] {
+			seen[node] = true
+			b, err := xml.Marshal(node)
+			if err != nil {
+				return err
+			}
+			w.Write(b)
 			chunk, err := parser.ParseNode(node)
 			if err != nil {
 				return err
 			}
 			ifaces = merge(ifaces, chunk)
-			return nil
-		}); err != nil {
-			return nil, err
+		}
+		locate(ifaces, dest, path, node)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if !parser.IsStandard(iface.Name) {
+			iface.PathTemplate = inferPathTemplate(iface.Paths)
 		}
 	}
 	return ifaces, nil
 }
 
-func generateXML(conn *dbus.Conn, dests []string) ([]byte, error) {
+// locate records the destination and the path the node's interfaces
+// are found at, only well-known names are recorded, because
+// unique names and peers without names change every run.
+func locate(ifaces []*token.Interface, dest string, path dbus.ObjectPath, node *introspect.Node) {
+	if dest == "" || dest[0] == ':' {
+		return
+	}
+	for _, ifn := range node.Interfaces {
+		for _, iface := range ifaces {
+			if iface.Name == ifn.Name {
+				iface.Dests = appendUnique(iface.Dests, dest)
+				iface.Paths = appendUnique(iface.Paths, string(path))
+				break
+			}
+		}
+	}
+}
+
+func appendUnique(ss []string, s string) []string {
+	for _, v := range ss {
+		if v == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+func generateXML(j *job) ([]byte, error) {
 	var ifaces []introspect.Interface
-	for _, dest := range dests {
-		if err := introspectDest(conn, dest, "/", func(n *introspect.Node) error {
-			for _, ifn := range n.Interfaces {
-				var found bool
-				for _, ifc := range ifaces {
-					if ifc.Name == ifn.Name {
-						found = true
-						break
-					}
-				}
-				if !found {
-					ifaces = append(ifaces, ifn)
+	if err := j.introspect(func(dest string, path dbus.ObjectPath, n *introspect.Node) error {
+		for _, ifn := range n.Interfaces {
+			var found bool
+			for _, ifc := range ifaces {
+				if ifc.Name == ifn.Name {
+					found = true
+					break
 				}
 			}
-			return nil
-		}); err != nil {
-			return nil, err
+			if !found {
+				ifaces = append(ifaces, ifn)
+			}
 		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 	return xml.MarshalIndent(&introspect.Node{
 		Interfaces: ifaces,
 	}, "", "\t")
 }
 
+// applyStandard adds standard interfaces shipped with the tool to ifaces
+// or removes them according to the job's mode, built-in ones replace
+// the same interfaces given by inputs, so they don't depend on them.
+func (j *job) applyStandard(ifaces []*token.Interface, w io.Writer) []*token.Interface {
+	switch j.Standard {
+	case "include", "only":
+		io.WriteString(w, parser.StandardXML)
+		return merge(parser.Standard(), ifaces)
+	case "exclude":
+		var kept []*token.Interface
+		for _, iface := range ifaces {
+			if !parser.IsStandard(iface.Name) {
+				kept = append(kept, iface)
+			}
+		}
+		return kept
+	default:
+		return ifaces
+	}
+}
+
 func merge(curr, next []*token.Interface) []*token.Interface {
 	for _, ifn := range next {
 		var found bool
@@ -203,39 +545,9 @@ func merge(curr, next []*token.Interface) []*token.Interface {
 	return curr
 }
 
-func includes(ss []string, s string) bool {
-	for i := range ss {
-		if ss[i] == s {
-			return true
-		}
-	}
-	return false
-}
-
-func introspectDest(
-	conn *dbus.Conn, dest string, path dbus.ObjectPath,
-	fn func(node *introspect.Node) error,
-) error {
-	var s string
-	if err := conn.Object(dest, path).Call(
-		"org.freedesktop.DBus.Introspectable.Introspect", 0,
-	).Store(&s); err != nil {
-		return err
-	}
-	var node introspect.Node
-	if err := xml.Unmarshal([]byte(s), &node); err != nil {
-		return err
-	}
-	if err := fn(&node); err != nil {
-		return err
-	}
-	if path == "/" {
-		path = ""
-	}
-	for _, child := range node.Children {
-		if err := introspectDest(conn, dest, path+"/"+dbus.ObjectPath(child.Name), fn); err != nil {
-			return err
-		}
-	}
-	return nil
+// splitList splits the comma-separated list skipping empty elements.
+func splitList(s string) []string {
+	var ss stringsFlag
+	_ = ss.Set(s)
+	return ss
 }
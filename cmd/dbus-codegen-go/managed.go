@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// walkManaged enumerates objects under root with GetManagedObjects
+// and introspects only one representative object per distinct set
+// of interfaces, that is shared by all objects of the set.
+//
+// It returns nil when root doesn't implement org.freedesktop.DBus.ObjectManager
+// and the tree has to be walked recursively.
+func (in *introspector) walkManaged(
+	ctx context.Context, cancel context.CancelFunc,
+	dest string, root dbus.ObjectPath,
+) *object {
+	if in.excluded(root) {
+		return nil
+	}
+	var managed map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	if err := in.call(ctx, dest, root,
+		"org.freedesktop.DBus.ObjectManager.GetManagedObjects", &managed,
+	); err != nil {
+		return nil
+	}
+
+	paths := make([]dbus.ObjectPath, 0, len(managed))
+	for path := range managed {
+		if path != root && in.below(root, path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i] < paths[j]
+	})
+
+	// objects are grouped by their interface sets, first ones represent groups
+	keys := make(map[dbus.ObjectPath]string, len(paths))
+	reps := map[string]*object{}
+	for _, path := range paths {
+		names := make([]string, 0, len(managed[path]))
+		for name := range managed[path] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		keys[path] = strings.Join(names, " ")
+		if _, ok := reps[keys[path]]; !ok {
+			reps[keys[path]] = &object{path: path}
+		}
+	}
+
+	obj := &object{path: root}
+	var wg sync.WaitGroup
+	for _, o := range append([]*object{obj}, objectsOf(reps)...) {
+		o := o
+		in.spawn(&wg, func() {
+			o.node, o.err = in.introspect(ctx, dest, o.path)
+			if o.err != nil && (o == obj || !in.skip) {
+				in.fail(fmt.Errorf("%s %s: %s", dest, o.path, o.err))
+				cancel()
+			}
+		})
+	}
+	wg.Wait()
+	if obj.err != nil {
+		return obj
+	}
+
+	for _, path := range paths {
+		rep := reps[keys[path]]
+		switch {
+		case rep.path == path:
+			obj.children = append(obj.children, rep)
+		case rep.err == nil:
+			obj.children = append(obj.children, &object{path: path, node: rep.node})
+		}
+	}
+	return obj
+}
+
+// below reports whether the managed object at path is under root
+// and passes -depth and -path-except filters.
+func (in *introspector) below(root, path dbus.ObjectPath) bool {
+	prefix := strings.TrimSuffix(string(root), "/") + "/"
+	if !strings.HasPrefix(string(path), prefix) {
+		return false
+	}
+	if in.depth >= 0 && strings.Count(string(path[len(prefix):]), "/") >= in.depth {
+		return false
+	}
+	return !in.excluded(path)
+}
+
+// excluded reports whether the path or any of its parents matches -path-except,
+// the same way recursive walks skip subtrees of excluded objects.
+func (in *introspector) excluded(path dbus.ObjectPath) bool {
+	s := string(path)
+	for !matchAny(in.except, s) {
+		if s == "/" {
+			return false
+		}
+		if s = s[:strings.LastIndexByte(s, '/')]; s == "" {
+			s = "/"
+		}
+	}
+	return true
+}
+
+func objectsOf(m map[string]*object) []*object {
+	objs := make([]*object, 0, len(m))
+	for _, obj := range m {
+		objs = append(objs, obj)
+	}
+	return objs
+}
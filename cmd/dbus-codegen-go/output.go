@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// writeFiles writes the files mapped by their paths creating
+// missing directories, files whose content hasn't changed are left intact,
+// extra files are removed.
+func writeFiles(files map[string][]byte, extra []string) error {
+	for _, name := range sortedNames(files) {
+		if err := writeFile(name, files[name]); err != nil {
+			return err
+		}
+	}
+	for _, name := range extra {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile atomically replaces the named file unless it already has the content.
+func writeFile(name string, b []byte) error {
+	if curr, err := ioutil.ReadFile(name); err == nil && bytes.Equal(curr, b) {
+		return nil
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// checkFiles returns an error when any of the files differ
+// from their content on disk or extra files would be removed.
+func checkFiles(files map[string][]byte, extra []string) error {
+	var stale []string
+	for _, name := range sortedNames(files) {
+		curr, err := ioutil.ReadFile(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err != nil || !bytes.Equal(curr, files[name]) {
+			stale = append(stale, name)
+		}
+	}
+	stale = append(stale, extra...)
+	if len(stale) != 0 {
+		for _, name := range stale {
+			fmt.Fprintf(os.Stderr, "stale: %s\n", name)
+		}
+		return fmt.Errorf("%d generated file(s) are out of date", len(stale))
+	}
+	return nil
+}
+
+// generatedHeader starts every Go file the generator writes.
+const generatedHeader = "// Code generated by dbus-codegen-go "
+
+// extraFiles lists generated Go files of the pkg package in the directory
+// that aren't among the files, like ones of interfaces that are no longer
+// generated, mock files are compared only with mocks, so both may share
+// the directory, and files of other packages are never listed.
+func extraFiles(dir string, files map[string][]byte, mock bool, pkg string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var extra []string
+	for _, info := range infos {
+		name := filepath.Join(dir, info.Name())
+		if !info.Mode().IsRegular() || !strings.HasSuffix(name, ".go") ||
+			strings.HasSuffix(name, "_mock.go") != mock || files[name] != nil {
+			continue
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(b, []byte(generatedHeader)) && packageOf(b) == pkg {
+			extra = append(extra, name)
+		}
+	}
+	return extra, nil
+}
+
+// packageOf returns the package name of the Go source
+// or an empty string when it cannot be parsed.
+func packageOf(b []byte) string {
+	f, err := goparser.ParseFile(gotoken.NewFileSet(), "", b, goparser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return f.Name.Name
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
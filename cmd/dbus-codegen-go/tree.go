@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// runXML writes introspection documents instead of generating code,
+// flattened by default or keeping object trees when tree is set.
+func (j *job) runXML(tree, collapse bool) error {
+	if j.Out != "" && j.Output != "" {
+		return errors.New("cannot combine -o and -out flags")
+	}
+	if checkFlag && j.Out == "" && j.Output == "" {
+		return errors.New("flag -check cannot be used without -o or -out flag")
+	}
+	var docs map[string][]byte
+	if tree {
+		var err error
+		if docs, err = generateTrees(j, collapse); err != nil {
+			return err
+		}
+	} else {
+		if j.Out != "" {
+			return errors.New("flag -out cannot be used with -xml flag without -xml-tree")
+		}
+		b, err := generateXML(j)
+		if err != nil {
+			return err
+		}
+		docs = map[string][]byte{"": append(b, '\n')}
+	}
+	if len(docs) > 1 && j.Out == "" {
+		return errors.New("several destinations produce several documents, use -out flag")
+	}
+
+	files := make(map[string][]byte, len(docs))
+	for name, b := range docs {
+		switch {
+		case j.Out != "":
+			files[filepath.Join(j.Out, name)] = b
+		case j.Output != "":
+			files[j.Output] = b
+		default:
+			_, err := os.Stdout.Write(b)
+			return err
+		}
+	}
+	if checkFlag {
+		return checkFiles(files, nil)
+	}
+	return writeFiles(files, nil)
+}
+
+// generateTrees introspects the job's destinations keeping their object
+// trees and returns one document per destination mapped by file names,
+// collapse merges identical sibling objects into templates.
+func generateTrees(j *job, collapse bool) (map[string][]byte, error) {
+	var dests []string
+	trees := map[string]*introspect.Node{}
+	if err := j.introspect(func(dest string, path dbus.ObjectPath, node *introspect.Node) error {
+		root, ok := trees[dest]
+		if !ok {
+			root = &introspect.Node{}
+			trees[dest] = root
+			dests = append(dests, dest)
+		}
+		insertNode(root, path, node)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(dests))
+	for _, dest := range dests {
+		if collapse {
+			collapseNode(trees[dest])
+		}
+		b, err := xml.MarshalIndent(trees[dest], "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		name := dest
+		if name == "" {
+			name = "peer"
+		}
+		files[name+".xml"] = append(b, '\n')
+	}
+	return files, nil
+}
+
+// insertNode puts interfaces of the node to the tree under root
+// at the given path, creating missing intermediate nodes.
+func insertNode(root *introspect.Node, path dbus.ObjectPath, node *introspect.Node) {
+	curr := root
+	if path != "/" {
+	Elems:
+		for _, elem := range strings.Split(string(path[1:]), "/") {
+			for i := range curr.Children {
+				if curr.Children[i].Name == elem {
+					curr = &curr.Children[i]
+					continue Elems
+				}
+			}
+			curr.Children = append(curr.Children, introspect.Node{Name: elem})
+			curr = &curr.Children[len(curr.Children)-1]
+		}
+	}
+	curr.Interfaces = node.Interfaces
+}
+
+// collapseNode replaces groups of identical children of the node,
+// including their subtrees, with single templates named with
+// path patterns, like unit_* for unit_1 and unit_2.
+func collapseNode(node *introspect.Node) {
+	var keys []string
+	groups := map[string][]introspect.Node{}
+	for _, child := range node.Children {
+		collapseNode(&child)
+		name := child.Name
+		child.Name = ""
+		b, _ := xml.Marshal(&child) // nodes always marshal
+		child.Name = name
+		key := string(b)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], child)
+	}
+	node.Children = node.Children[:0]
+	for _, key := range keys {
+		child := groups[key][0]
+		if len(groups[key]) > 1 {
+			names := make([]string, len(groups[key]))
+			for i := range groups[key] {
+				names[i] = groups[key][i].Name
+			}
+			child.Name = template(names)
+		}
+		node.Children = append(node.Children, child)
+	}
+}
+
+// template returns the pattern matching all the names.
+func template(names []string) string {
+	prefix, suffix := names[0], names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+		for !strings.HasSuffix(name, suffix) {
+			suffix = suffix[1:]
+		}
+	}
+	for _, name := range names {
+		if len(prefix)+len(suffix) > len(name) {
+			suffix = suffix[len(prefix)+len(suffix)-len(name):]
+		}
+	}
+	return prefix + "*" + suffix
+}
+
+var placeholderRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// inferPathTemplate guesses the template of paths the interface is found at,
+// differing elements become placeholders named after their common leading
+// letters or the preceding element, values that all look escaped by systemd
+// make escaped placeholders. It returns an empty string when there're
+// less than two paths or they have different depths.
+func inferPathTemplate(paths []string) string {
+	if len(paths) < 2 {
+		return ""
+	}
+	elems := make([][]string, len(paths))
+	for i, path := range paths {
+		if path == "/" {
+			return ""
+		}
+		elems[i] = strings.Split(path[1:], "/")
+		if len(elems[i]) != len(elems[0]) {
+			return ""
+		}
+	}
+
+	var buf strings.Builder
+	names := map[string]bool{}
+	literal := false // whether the previous element is literal
+	for i := range elems[0] {
+		values := make([]string, len(elems))
+		same := true
+		for k := range elems {
+			values[k] = elems[k][i]
+			same = same && values[k] == values[0]
+		}
+		buf.WriteByte('/')
+		if same {
+			buf.WriteString(values[0])
+			literal = true
+			continue
+		}
+
+		var prefix, modifier string
+		if escaped(values) {
+			modifier = ":escape"
+		} else {
+			prefix = letterPrefix(values)
+		}
+		name := strings.TrimSuffix(prefix, "_")
+		if name == "" && literal {
+			name = elems[0][i-1]
+		}
+		if !placeholderRegexp.MatchString(name) || names[name] {
+			name = "v" + strconv.Itoa(i)
+		}
+		names[name] = true
+		buf.WriteString(prefix + "{" + name + modifier + "}")
+		literal = false
+	}
+	return buf.String()
+}
+
+// letterPrefix returns leading letters common for all values
+// followed by an underscore when all of them have it there.
+func letterPrefix(values []string) string {
+	var n int
+	for ; n < len(values[0]); n++ {
+		c := values[0][n]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' && n != 0) {
+			break
+		}
+		for _, v := range values[1:] {
+			if n >= len(v) || v[n] != c {
+				return values[0][:n]
+			}
+		}
+		if c == '_' {
+			return values[0][:n+1]
+		}
+	}
+	return values[0][:n]
+}
+
+// escaped reports whether all values look escaped with rt.EscapePathLabel:
+// underscores are only followed by lowercase hex codes of bytes that
+// are escaped and aren't control characters, and at least one of
+// the values has such a code.
+func escaped(values []string) bool {
+	var found bool
+	for _, v := range values {
+		for i := 0; i < len(v); i++ {
+			if v[i] != '_' {
+				continue
+			}
+			if v == "_" {
+				found = true
+				break
+			}
+			if i+2 >= len(v) {
+				return false
+			}
+			c, err := strconv.ParseUint(v[i+1:i+3], 16, 8)
+			if err != nil || strings.ToLower(v[i+1:i+3]) != v[i+1:i+3] {
+				return false
+			}
+			if c < ' ' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+				return false // never escaped or unlikely in names
+			}
+			found = true
+			i += 2
+		}
+	}
+	return found
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"strings"
@@ -9,33 +10,189 @@ import (
 	"github.com/tq-systems/go-dbus-codegen/token"
 )
 
-// Parse parses the given introspection XML into a list of interfaces.
+// Parse parses the given introspection XML into a list of interfaces,
+// Telepathy spec extensions are parsed as well, see TelepathyNamespace.
 func Parse(b []byte) ([]*token.Interface, error) {
 	var node introspect.Node
 	if err := xml.Unmarshal(b, &node); err != nil {
 		return nil, err
 	}
-	return ParseNode(&node)
+	if !bytes.Contains(b, []byte(TelepathyNamespace)) {
+		return ParseNode(&node)
+	}
+
+	var tp tpNode
+	if err := xml.Unmarshal(b, &tp); err != nil {
+		return nil, err
+	}
+	tp.fixTypes(&node)
+	ifaces, err := ParseNode(&node)
+	if err != nil {
+		return nil, err
+	}
+	if err = parseTelepathy(&tp, ifaces); err != nil {
+		return nil, err
+	}
+	return ifaces, nil
 }
 
 // ParseNode parses the given node, used to avoid double unmarshalling.
+//
+// Interfaces of child nodes are parsed as well, so documents that keep
+// the whole object tree produce the same result as flattened ones,
+// an interface implemented by several objects is returned only once.
 func ParseNode(node *introspect.Node) ([]*token.Interface, error) {
 	if node == nil {
 		panic("node is nil")
 	}
-	ifaces := make([]*token.Interface, len(node.Interfaces))
-	for i := range node.Interfaces {
-		ifaces[i] = &token.Interface{
-			Name:        node.Interfaces[i].Name,
-			Methods:     parseMethods(node.Interfaces[i].Methods),
-			Properties:  parseProperties(node.Interfaces[i].Properties),
-			Signals:     parseSignals(node.Interfaces[i].Signals),
-			Annotations: parseAnnotations(node.Interfaces[i].Annotations),
+	ifaces := make([]*token.Interface, 0, len(node.Interfaces))
+	seen := map[string]bool{}
+	walkNode(node, func(iface *introspect.Interface) {
+		if seen[iface.Name] {
+			return
 		}
+		seen[iface.Name] = true
+		ifaces = append(ifaces, &token.Interface{
+			Name:        iface.Name,
+			Methods:     parseMethods(iface.Methods),
+			Properties:  parseProperties(iface.Properties),
+			Signals:     parseSignals(iface.Signals),
+			Annotations: parseAnnotations(iface.Annotations),
+		})
+	})
+	for _, iface := range ifaces {
+		if err := parseRefs(iface); err != nil {
+			return nil, err
+		}
+	}
+	if err := parseEnums(ifaces); err != nil {
+		return nil, err
 	}
 	return ifaces, nil
 }
 
+// RefAnnotation declares the interface of objects an o or ao property refers to,
+// annotations of methods and signals append a dot and the argument name
+// or position to it, like dbusgen.Ref.out0.
+const RefAnnotation = "dbusgen.Ref"
+
+// parseRefs sets Ref of arguments addressed by RefAnnotation.
+func parseRefs(iface *token.Interface) error {
+	return walkArgAnnotations(iface, RefAnnotation, func(arg *token.Arg, value string) error {
+		arg.Ref = value
+		return nil
+	})
+}
+
+// EnumAnnotation and FlagsAnnotation followed by a dot and a type name
+// declare an enum or a flag set on an interface, their values are
+// comma-separated NAME=VALUE pairs, like dbusgen.Enum.State = "Off=0,On=1".
+//
+// EnumAnnotation on a property makes it of the named enum type,
+// annotations of methods and signals address arguments the same
+// way RefAnnotation does, like dbusgen.Enum.out0.
+const (
+	EnumAnnotation  = "dbusgen.Enum"
+	FlagsAnnotation = "dbusgen.Flags"
+)
+
+// parseEnums parses enums declared by the interfaces
+// and applies them to arguments addressed by EnumAnnotation.
+func parseEnums(ifaces []*token.Interface) error {
+	enums := map[string]*token.Enum{}
+	for _, iface := range ifaces {
+		for _, annotation := range iface.Annotations {
+			enum := &token.Enum{}
+			switch {
+			case strings.HasPrefix(annotation.Name, EnumAnnotation+"."):
+				enum.Name = annotation.Name[len(EnumAnnotation)+1:]
+			case strings.HasPrefix(annotation.Name, FlagsAnnotation+"."):
+				enum.Name, enum.Flags = annotation.Name[len(FlagsAnnotation)+1:], true
+			default:
+				continue
+			}
+			if enums[enum.Name] != nil {
+				return fmt.Errorf("%s: enum %s is declared twice", iface.Name, enum.Name)
+			}
+			var err error
+			if enum.Values, err = token.ParseEnumValues(annotation.Value); err != nil {
+				return fmt.Errorf("%s: %s", iface.Name, err)
+			}
+			enums[enum.Name] = enum
+			iface.Enums = append(iface.Enums, enum)
+		}
+	}
+	for _, iface := range ifaces {
+		if err := walkArgAnnotations(iface, EnumAnnotation, func(arg *token.Arg, value string) error {
+			enum := enums[value]
+			if enum == nil {
+				return fmt.Errorf("unknown enum %q", value)
+			}
+			return enum.Apply(arg)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkArgAnnotations calls fn for properties annotated with the name
+// and arguments of methods and signals annotated with the name
+// followed by a dot and the argument's name or position.
+func walkArgAnnotations(iface *token.Interface, name string, fn func(arg *token.Arg, value string) error) error {
+	for _, prop := range iface.Properties {
+		for _, annotation := range prop.Annotations {
+			if annotation.Name != name {
+				continue
+			}
+			if err := fn(prop.Arg, annotation.Value); err != nil {
+				return fmt.Errorf("%s.%s: %s", iface.Name, prop.Name, err)
+			}
+		}
+	}
+	for _, method := range iface.Methods {
+		if err := walkMemberAnnotations(iface.Name+"."+method.Name, method.Annotations, name, method.Arg, fn); err != nil {
+			return err
+		}
+	}
+	for _, signal := range iface.Signals {
+		if err := walkMemberAnnotations(iface.Name+"."+signal.Name, signal.Annotations, name, signal.Arg, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkMemberAnnotations(
+	member string, annotations []*token.Annotation, name string,
+	lookup func(name string) *token.Arg, fn func(arg *token.Arg, value string) error,
+) error {
+	for _, annotation := range annotations {
+		if !strings.HasPrefix(annotation.Name, name+".") {
+			continue
+		}
+		argName := annotation.Name[len(name)+1:]
+		arg := lookup(argName)
+		if arg == nil {
+			return fmt.Errorf("%s: %s refers to unknown argument %q", member, annotation.Name, argName)
+		}
+		if err := fn(arg, annotation.Value); err != nil {
+			return fmt.Errorf("%s: %s", member, err)
+		}
+	}
+	return nil
+}
+
+// walkNode calls fn for interfaces of the node and its children in depth-first order.
+func walkNode(node *introspect.Node, fn func(iface *introspect.Interface)) {
+	for i := range node.Interfaces {
+		fn(&node.Interfaces[i])
+	}
+	for i := range node.Children {
+		walkNode(&node.Children[i], fn)
+	}
+}
+
 func parseMethods(methods []introspect.Method) []*token.Method {
 	list := make([]*token.Method, len(methods))
 	for i := range methods {
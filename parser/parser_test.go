@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
 )
 
 func TestParseSig(t *testing.T) {
@@ -32,3 +35,198 @@ func TestParseSig(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTree(t *testing.T) {
+	t.Parallel()
+	ifaces, err := Parse([]byte(`<node>
+	<interface name="a"><method name="M"/></interface>
+	<node name="x">
+		<interface name="b"/>
+		<node name="y"><interface name="a"/><interface name="c"/></node>
+	</node>
+	<node name="z"><interface name="b"/></node>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+	}
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Errorf("Parse() interfaces = %v, want [a b c]", names)
+	}
+	if len(ifaces[0].Methods) != 1 {
+		t.Errorf("Parse() took interface a from a child node")
+	}
+}
+
+func TestStandard(t *testing.T) {
+	t.Parallel()
+	ifaces := Standard()
+	if len(ifaces) != 4 {
+		t.Fatalf("Standard() returned %d interfaces, want 4", len(ifaces))
+	}
+	for _, iface := range ifaces {
+		if !IsStandard(iface.Name) {
+			t.Errorf("IsStandard(%q) = false, want true", iface.Name)
+		}
+	}
+	if IsStandard("org.freedesktop.DBus") {
+		t.Errorf("IsStandard(%q) = true, want false", "org.freedesktop.DBus")
+	}
+}
+
+func TestParseRefs(t *testing.T) {
+	t.Parallel()
+	ifaces, err := Parse([]byte(`<node><interface name="org.Manager">
+	<method name="GetUnit">
+		<arg name="name" type="s" direction="in"/>
+		<arg name="unit" type="o" direction="out"/>
+		<annotation name="dbusgen.Ref.unit" value="org.Unit"/>
+	</method>
+	<method name="ListUnits">
+		<arg type="ao" direction="out"/>
+		<annotation name="dbusgen.Ref.out0" value="org.Unit"/>
+	</method>
+	<property name="Default" type="o" access="read">
+		<annotation name="dbusgen.Ref" value="org.Unit"/>
+	</property>
+</interface></node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := ifaces[0]
+	for _, arg := range []*token.Arg{
+		iface.Methods[0].Out[0], iface.Methods[1].Out[0], iface.Properties[0].Arg,
+	} {
+		if arg.Ref != "org.Unit" {
+			t.Errorf("%s Ref = %q, want org.Unit", arg.Name, arg.Ref)
+		}
+	}
+	if iface.Methods[0].In[0].Ref != "" {
+		t.Errorf("name Ref = %q, want none", iface.Methods[0].In[0].Ref)
+	}
+
+	if _, err = Parse([]byte(`<node><interface name="org.Manager">
+	<method name="GetUnit">
+		<annotation name="dbusgen.Ref.unit" value="org.Unit"/>
+	</method>
+</interface></node>`)); err == nil {
+		t.Error("Parse() with unknown argument succeeded")
+	}
+}
+
+func TestParseEnums(t *testing.T) {
+	t.Parallel()
+	ifaces, err := Parse([]byte(`<node><interface name="org.Device">
+	<annotation name="dbusgen.Enum.State" value="Off=0, On=1"/>
+	<annotation name="dbusgen.Flags.Caps" value="Read=0x1,Write=0x2"/>
+	<method name="ListCaps">
+		<arg name="caps" type="aq" direction="out"/>
+		<annotation name="dbusgen.Enum.caps" value="Caps"/>
+	</method>
+	<property name="State" type="u" access="read">
+		<annotation name="dbusgen.Enum" value="State"/>
+	</property>
+</interface></node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := ifaces[0]
+	if len(iface.Enums) != 2 {
+		t.Fatalf("len(Enums) = %d, want 2", len(iface.Enums))
+	}
+	state, caps := iface.Enums[0], iface.Enums[1]
+	if state.Name != "State" || state.Flags || state.Type != "uint32" || len(state.Values) != 2 ||
+		*state.Values[1] != (token.EnumValue{Name: "On", Value: 1}) {
+		t.Errorf("State = %+v", state)
+	}
+	if caps.Name != "Caps" || !caps.Flags || caps.Type != "uint16" {
+		t.Errorf("Caps = %+v", caps)
+	}
+	if have := iface.Methods[0].Out[0].Type; have != "[]Caps" {
+		t.Errorf("caps Type = %q, want []Caps", have)
+	}
+	if have := iface.Properties[0].Arg.Type; have != "State" {
+		t.Errorf("State Type = %q, want State", have)
+	}
+
+	for _, xml := range []string{
+		`<annotation name="dbusgen.Enum.State" value="Off"/>`,
+		`<property name="State" type="u" access="read">
+			<annotation name="dbusgen.Enum" value="State"/>
+		</property>`,
+		`<annotation name="dbusgen.Enum.State" value="Off=0"/>
+		<property name="State" type="s" access="read">
+			<annotation name="dbusgen.Enum" value="State"/>
+		</property>`,
+	} {
+		if _, err = Parse([]byte(`<node><interface name="org.Device">` + xml + `</interface></node>`)); err == nil {
+			t.Errorf("Parse(%s) succeeded", xml)
+		}
+	}
+}
+
+func TestParseTelepathy(t *testing.T) {
+	t.Parallel()
+	ifaces, err := Parse([]byte(`<node xmlns:tp="http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0">
+<tp:enum name="Handle_Type" type="u">
+	<tp:enumvalue suffix="None" value="0"/>
+	<tp:enumvalue suffix="Contact" value="1"/>
+</tp:enum>
+<interface name="org.Connection">
+	<tp:struct name="Channel_Info">
+		<tp:member type="o" name="Channel"/>
+		<tp:member type="u" name="Handle_Type" tp:type="Handle_Type"/>
+	</tp:struct>
+	<tp:mapping name="Handle_Map">
+		<tp:member type="u" name="Handle"/>
+		<tp:member type="(ou)" name="Info" tp:type="Channel_Info"/>
+	</tp:mapping>
+	<method name="ListChannels">
+		<arg direction="out" tp:type="Channel_Info[]" type="a(ou)"/>
+	</method>
+	<property name="Handles" type="a{u(ou)}" tp:type="Handle_Map" access="read"/>
+	<signal name="Changed">
+		<arg name="type" type="u" tp:type="Handle_Type"/>
+		<arg name="handle" type="u" tp:type="Contact_Handle"/>
+	</signal>
+</interface></node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := ifaces[0]
+	if len(iface.Enums) != 1 || iface.Enums[0].Name != "HandleType" || len(iface.Enums[0].Values) != 2 {
+		t.Errorf("Enums = %+v", iface.Enums)
+	}
+	if len(iface.Types) != 2 {
+		t.Fatalf("len(Types) = %d, want 2", len(iface.Types))
+	}
+	info, handles := iface.Types[0], iface.Types[1]
+	if info.Name != "ChannelInfo" || info.Sig != "(ou)" || len(info.Fields) != 2 ||
+		*info.Fields[1] != (token.Arg{Name: "HandleType", Type: "HandleType"}) {
+		t.Errorf("ChannelInfo = %+v", info)
+	}
+	if handles.Name != "HandleMap" || handles.Sig != "a{u(ou)}" || handles.Type != "map[uint32]ChannelInfo" {
+		t.Errorf("HandleMap = %+v", handles)
+	}
+	for arg, want := range map[*token.Arg]string{
+		iface.Methods[0].Out[0]:  "[]ChannelInfo",
+		iface.Properties[0].Arg:  "HandleMap",
+		iface.Signals[0].Args[0]: "HandleType",
+		iface.Signals[0].Args[1]: "uint32",
+	} {
+		if arg.Type != want {
+			t.Errorf("%s Type = %q, want %q", arg.Name, arg.Type, want)
+		}
+	}
+
+	if _, err = Parse([]byte(`<node xmlns:tp="http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0">
+<interface name="org.Connection">
+	<tp:struct name="Info"><tp:member type="o" name="Path"/></tp:struct>
+	<property name="Info" type="(s)" tp:type="Info" access="read"/>
+</interface></node>`)); err == nil {
+		t.Error("Parse() with mismatching tp:type succeeded")
+	}
+}
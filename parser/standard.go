@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// StandardXML is the introspection of standard interfaces
+// defined by the D-Bus specification, that most objects implement.
+const StandardXML = `<node>
+	<interface name="org.freedesktop.DBus.Introspectable">
+		<method name="Introspect">
+			<arg name="xml_data" type="s" direction="out"/>
+		</method>
+	</interface>
+	<interface name="org.freedesktop.DBus.Peer">
+		<method name="Ping"/>
+		<method name="GetMachineId">
+			<arg name="machine_uuid" type="s" direction="out"/>
+		</method>
+	</interface>
+	<interface name="org.freedesktop.DBus.Properties">
+		<method name="Get">
+			<arg name="interface_name" type="s" direction="in"/>
+			<arg name="property_name" type="s" direction="in"/>
+			<arg name="value" type="v" direction="out"/>
+		</method>
+		<method name="Set">
+			<arg name="interface_name" type="s" direction="in"/>
+			<arg name="property_name" type="s" direction="in"/>
+			<arg name="value" type="v" direction="in"/>
+		</method>
+		<method name="GetAll">
+			<arg name="interface_name" type="s" direction="in"/>
+			<arg name="props" type="a{sv}" direction="out"/>
+		</method>
+		<signal name="PropertiesChanged">
+			<arg name="interface_name" type="s"/>
+			<arg name="changed_properties" type="a{sv}"/>
+			<arg name="invalidated_properties" type="as"/>
+		</signal>
+	</interface>
+	<interface name="org.freedesktop.DBus.ObjectManager">
+		<method name="GetManagedObjects">
+			<arg name="objects" type="a{oa{sa{sv}}}" direction="out"/>
+		</method>
+		<signal name="InterfacesAdded">
+			<arg name="object_path" type="o"/>
+			<arg name="interfaces_and_properties" type="a{sa{sv}}"/>
+		</signal>
+		<signal name="InterfacesRemoved">
+			<arg name="object_path" type="o"/>
+			<arg name="interfaces" type="as"/>
+		</signal>
+	</interface>
+</node>`
+
+// Standard returns newly parsed standard interfaces, see StandardXML.
+func Standard() []*token.Interface {
+	ifaces, err := Parse([]byte(StandardXML))
+	if err != nil {
+		panic(err)
+	}
+	return ifaces
+}
+
+// IsStandard reports whether the named interface is one of StandardXML.
+func IsStandard(name string) bool {
+	switch name {
+	case "org.freedesktop.DBus.Introspectable",
+		"org.freedesktop.DBus.Peer",
+		"org.freedesktop.DBus.Properties",
+		"org.freedesktop.DBus.ObjectManager":
+		return true
+	default:
+		return false
+	}
+}
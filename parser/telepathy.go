@@ -0,0 +1,395 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// TelepathyNamespace is the XML namespace of Telepathy spec extensions,
+// its tp:enum, tp:flags, tp:struct and tp:mapping elements of nodes
+// and interfaces declare named types that tp:type attributes
+// of arguments, properties and struct members refer to.
+const TelepathyNamespace = "http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0"
+
+type tpNode struct {
+	tpDecls
+	Interfaces []tpInterface `xml:"interface"`
+	Children   []tpNode      `xml:"node"`
+}
+
+type tpDecls struct {
+	Enums    []tpEnum   `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 enum"`
+	Flags    []tpEnum   `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 flags"`
+	Structs  []tpStruct `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 struct"`
+	Mappings []tpStruct `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 mapping"`
+}
+
+type tpInterface struct {
+	tpDecls
+	Name       string     `xml:"name,attr"`
+	Methods    []tpMember `xml:"method"`
+	Properties []tpArg    `xml:"property"`
+	Signals    []tpMember `xml:"signal"`
+}
+
+type tpMember struct {
+	Name string  `xml:"name,attr"`
+	Args []tpArg `xml:"arg"`
+}
+
+type tpEnum struct {
+	Name        string    `xml:"name,attr"`
+	Type        string    `xml:"type,attr"`
+	ValuePrefix string    `xml:"value-prefix,attr"`
+	Values      []tpValue `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 enumvalue"`
+	Flags       []tpValue `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 flag"`
+}
+
+type tpValue struct {
+	Suffix string `xml:"suffix,attr"`
+	Value  string `xml:"value,attr"`
+}
+
+type tpStruct struct {
+	Name    string  `xml:"name,attr"`
+	Members []tpArg `xml:"http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0 member"`
+}
+
+// tpArg is an argument, a property or a struct member.
+type tpArg struct {
+	Name      string
+	Type      string
+	Direction string
+	TpType    string
+}
+
+// UnmarshalXML reads attributes by hand, because struct tags
+// without a namespace match namespaced attributes as well,
+// so type and tp:type cannot be told apart with them.
+func (a *tpArg) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == TelepathyNamespace && attr.Name.Local == "type":
+			a.TpType = attr.Value
+		case attr.Name.Space != "":
+		case attr.Name.Local == "name":
+			a.Name = attr.Value
+		case attr.Name.Local == "type":
+			a.Type = attr.Value
+		case attr.Name.Local == "direction":
+			a.Direction = attr.Value
+		}
+	}
+	return d.Skip()
+}
+
+// fixTypes restores signatures of the node's arguments and
+// properties that introspect.Node takes from tp:type attributes.
+func (n *tpNode) fixTypes(node *introspect.Node) {
+	for i := range node.Interfaces {
+		iface, tp := &node.Interfaces[i], &n.Interfaces[i]
+		for j := range iface.Methods {
+			for k := range iface.Methods[j].Args {
+				iface.Methods[j].Args[k].Type = tp.Methods[j].Args[k].Type
+			}
+		}
+		for j := range iface.Properties {
+			iface.Properties[j].Type = tp.Properties[j].Type
+		}
+		for j := range iface.Signals {
+			for k := range iface.Signals[j].Args {
+				iface.Signals[j].Args[k].Type = tp.Signals[j].Args[k].Type
+			}
+		}
+	}
+	for i := range node.Children {
+		n.Children[i].fixTypes(&node.Children[i])
+	}
+}
+
+// tpTypes resolves tp:type references of a document.
+type tpTypes struct {
+	decls     map[string]interface{} // *tpEnum or *tpStruct by tp name
+	mappings  map[string]bool
+	enums     map[string]*token.Enum
+	types     map[string]*token.Type
+	resolving map[string]bool
+}
+
+func (r *tpTypes) declare(decls *tpDecls) error {
+	add := func(name string, decl interface{}) error {
+		if _, ok := r.decls[name]; ok {
+			return fmt.Errorf("tp type %s is declared twice", name)
+		}
+		r.decls[name] = decl
+		return nil
+	}
+	for i := range decls.Enums {
+		if err := add(decls.Enums[i].Name, &decls.Enums[i]); err != nil {
+			return err
+		}
+	}
+	for i := range decls.Flags {
+		if err := add(decls.Flags[i].Name, &decls.Flags[i]); err != nil {
+			return err
+		}
+	}
+	for i := range decls.Structs {
+		if err := add(decls.Structs[i].Name, &decls.Structs[i]); err != nil {
+			return err
+		}
+	}
+	for i := range decls.Mappings {
+		if err := add(decls.Mappings[i].Name, &decls.Mappings[i]); err != nil {
+			return err
+		}
+		r.mappings[decls.Mappings[i].Name] = true
+	}
+	return nil
+}
+
+// resolve returns the enum or the named type the tp name refers to,
+// both are nil for names that aren't declared by the document.
+func (r *tpTypes) resolve(name string) (*token.Enum, *token.Type, error) {
+	if enum, ok := r.enums[name]; ok {
+		return enum, nil, nil
+	}
+	if t, ok := r.types[name]; ok {
+		return nil, t, nil
+	}
+	if r.resolving[name] {
+		return nil, nil, fmt.Errorf("tp type %s refers to itself", name)
+	}
+	r.resolving[name] = true
+	defer delete(r.resolving, name)
+
+	switch decl := r.decls[name].(type) {
+	case *tpEnum:
+		enum, err := r.parseEnum(decl)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.enums[name] = enum
+		return enum, nil, nil
+	case *tpStruct:
+		t, err := r.parseStruct(decl, r.mappings[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		r.types[name] = t
+		return nil, t, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+func (r *tpTypes) parseEnum(decl *tpEnum) (*token.Enum, error) {
+	enum := &token.Enum{Name: tpIdent(decl.Name)}
+	if decl.Type != "" {
+		enum.Type = parseSig(decl.Type)
+	}
+	if decl.ValuePrefix != "" {
+		enum.Prefix = tpIdent(decl.ValuePrefix)
+	}
+	values := decl.Values
+	if len(decl.Flags) != 0 {
+		values, enum.Flags = decl.Flags, true
+	}
+	for _, v := range values {
+		n, err := strconv.ParseInt(v.Value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tp type %s: value %s: %s", decl.Name, v.Suffix, err)
+		}
+		enum.Values = append(enum.Values, &token.EnumValue{Name: tpIdent(v.Suffix), Value: n})
+	}
+	return enum, nil
+}
+
+func (r *tpTypes) parseStruct(decl *tpStruct, mapping bool) (*token.Type, error) {
+	t := &token.Type{Name: tpIdent(decl.Name)}
+	var sigs []string
+	var fields []*token.Arg
+	for i, member := range decl.Members {
+		field := parseArg(tpIdent(member.Name), member.Type)
+		if field.Name == "" {
+			field.Name = "V" + strconv.Itoa(i)
+		}
+		if err := r.apply(field, member.TpType); err != nil {
+			return nil, fmt.Errorf("tp type %s: %s", decl.Name, err)
+		}
+		sigs = append(sigs, member.Type)
+		fields = append(fields, field)
+	}
+	if !mapping {
+		t.Sig, t.Fields = "("+strings.Join(sigs, "")+")", fields
+		return t, nil
+	}
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("tp type %s: mapping has %d members, not 2", decl.Name, len(fields))
+	}
+	t.Sig = "a{" + sigs[0] + sigs[1] + "}"
+	t.Type = "map[" + fields[0].Type + "]" + fields[1].Type
+	return t, nil
+}
+
+// apply makes the argument of the type tp:type refers to,
+// it's kept as it is when the type is not declared by the document.
+func (r *tpTypes) apply(arg *token.Arg, tpType string) error {
+	name, slice := tpType, ""
+	for strings.HasSuffix(name, "[]") {
+		name, slice = name[:len(name)-2], slice+"[]"
+	}
+	enum, t, err := r.resolve(name)
+	switch {
+	case err != nil:
+		return err
+	case enum != nil && len(slice) <= 2:
+		return enum.Apply(arg)
+	case t != nil:
+		if want := slice + parseSig(t.Sig); arg.Type != want {
+			return fmt.Errorf("%s of type %s cannot be of tp type %s", arg.Name, arg.Type, tpType)
+		}
+		arg.Type = slice + t.Name
+	}
+	return nil
+}
+
+// parseTelepathy applies Telepathy extensions of the document
+// to interfaces ParseNode returned, types declared by nodes
+// are added to all the interfaces along with their own types.
+func parseTelepathy(root *tpNode, ifaces []*token.Interface) error {
+	r := &tpTypes{
+		decls:     map[string]interface{}{},
+		mappings:  map[string]bool{},
+		enums:     map[string]*token.Enum{},
+		types:     map[string]*token.Type{},
+		resolving: map[string]bool{},
+	}
+	var nodeDecls []*tpDecls
+	tpIfaces := map[string]*tpInterface{}
+	var walk func(n *tpNode) error
+	walk = func(n *tpNode) error {
+		if err := r.declare(&n.tpDecls); err != nil {
+			return err
+		}
+		nodeDecls = append(nodeDecls, &n.tpDecls)
+		for i := range n.Interfaces {
+			if _, ok := tpIfaces[n.Interfaces[i].Name]; ok {
+				continue
+			}
+			if err := r.declare(&n.Interfaces[i].tpDecls); err != nil {
+				return fmt.Errorf("%s: %s", n.Interfaces[i].Name, err)
+			}
+			tpIfaces[n.Interfaces[i].Name] = &n.Interfaces[i]
+		}
+		for i := range n.Children {
+			if err := walk(&n.Children[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return err
+	}
+
+	// appends declarations to the interface in document order
+	addDecls := func(iface *token.Interface, decls *tpDecls) error {
+		var names []string
+		for _, list := range [][]tpEnum{decls.Enums, decls.Flags} {
+			for _, decl := range list {
+				names = append(names, decl.Name)
+			}
+		}
+		for _, list := range [][]tpStruct{decls.Structs, decls.Mappings} {
+			for _, decl := range list {
+				names = append(names, decl.Name)
+			}
+		}
+		for _, name := range names {
+			enum, t, err := r.resolve(name)
+			if err != nil {
+				return err
+			}
+			if enum != nil {
+				iface.Enums = append(iface.Enums, enum)
+			} else {
+				iface.Types = append(iface.Types, t)
+			}
+		}
+		return nil
+	}
+	for _, iface := range ifaces {
+		tp := tpIfaces[iface.Name]
+		if tp == nil {
+			continue
+		}
+		for _, decls := range append(nodeDecls, &tp.tpDecls) {
+			if err := addDecls(iface, decls); err != nil {
+				return fmt.Errorf("%s: %s", iface.Name, err)
+			}
+		}
+		if err := applyTelepathy(r, iface, tp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTelepathy applies tp:type attributes of the interface's
+// arguments and properties, ParseNode keeps their order.
+func applyTelepathy(r *tpTypes, iface *token.Interface, tp *tpInterface) error {
+	apply := func(where string, arg *token.Arg, tpType string) error {
+		if tpType == "" {
+			return nil
+		}
+		if err := r.apply(arg, tpType); err != nil {
+			return fmt.Errorf("%s.%s: %s", iface.Name, where, err)
+		}
+		return nil
+	}
+	for i, prop := range iface.Properties {
+		if err := apply(prop.Name, prop.Arg, tp.Properties[i].TpType); err != nil {
+			return err
+		}
+	}
+	for i, method := range iface.Methods {
+		var in, out int
+		for _, arg := range tp.Methods[i].Args {
+			var err error
+			switch arg.Direction {
+			case "in":
+				err = apply(method.Name, method.In[in], arg.TpType)
+				in++
+			case "out":
+				err = apply(method.Name, method.Out[out], arg.TpType)
+				out++
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i, signal := range iface.Signals {
+		for j, arg := range tp.Signals[i].Args {
+			if err := apply(signal.Name, signal.Args[j], arg.TpType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tpIdent converts names like Connection_Status into Go identifiers.
+func tpIdent(name string) string {
+	parts := strings.Split(name, "_")
+	for i := range parts {
+		parts[i] = strings.Title(parts[i])
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,187 @@
+package printer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// WithEnums adds enums and flag sets that aren't declared
+// by interfaces, like the ones of the config file,
+// enums of the same name must have the same definition.
+func WithEnums(enums []*token.Enum) PrintOption {
+	return func(p *printer) {
+		p.enums = append(p.enums, enums...)
+	}
+}
+
+// enumRanges are ranges of values of underlying enum types.
+var enumRanges = map[string][2]int64{
+	"byte":   {0, math.MaxUint8},
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"uint16": {0, math.MaxUint16},
+	"int32":  {math.MinInt32, math.MaxInt32},
+	"uint32": {0, math.MaxUint32},
+	"int64":  {math.MinInt64, math.MaxInt64},
+	"uint64": {0, math.MaxInt64},
+}
+
+// collectEnums merges enums of the options and the interfaces,
+// sorts them by name and checks that they can be declared
+// along with the already declared package-level identifiers.
+func (p *printer) collectEnums(ifaces []*token.Interface, declared scope) error {
+	byName := map[string]*token.Enum{}
+	var enums []*token.Enum
+	add := func(enum *token.Enum) error {
+		if prev, ok := byName[enum.Name]; ok {
+			if !sameEnums(prev, enum) {
+				return fmt.Errorf("enum %s has different definitions", enum.Name)
+			}
+			return nil
+		}
+		byName[enum.Name] = enum
+		enums = append(enums, enum)
+		return nil
+	}
+	for _, enum := range p.enums {
+		if err := add(enum); err != nil {
+			return err
+		}
+	}
+	for _, iface := range ifaces {
+		for _, enum := range iface.Enums {
+			if err := add(enum); err != nil {
+				return fmt.Errorf("%s: %s", iface.Name, err)
+			}
+		}
+	}
+	sort.Slice(enums, func(i, j int) bool {
+		return enums[i].Name < enums[j].Name
+	})
+
+	for _, enum := range enums {
+		if enum.Type == "" {
+			enum.Type = "uint32"
+		}
+		r, ok := enumRanges[enum.Type]
+		if !ok {
+			return fmt.Errorf("enum %s cannot be of type %s", enum.Name, enum.Type)
+		}
+		for _, name := range append([]string{enum.Name}, p.enumConsts(enum)...) {
+			if err := declareTypeIdent(declared, name); err != nil {
+				return fmt.Errorf("enum %s: %s", enum.Name, err)
+			}
+		}
+		for _, v := range enum.Values {
+			if v.Value < r[0] || v.Value > r[1] {
+				return fmt.Errorf("enum %s: %s value %d overflows %s", enum.Name, v.Name, v.Value, enum.Type)
+			}
+		}
+	}
+	p.enums = enums
+	return nil
+}
+
+// declareTypeIdent adds the exported identifier of
+// a declared type or its constant to the scope.
+func declareTypeIdent(declared scope, name string) error {
+	if !identRegexp.MatchString(name) || !unicode.IsUpper(rune(name[0])) {
+		return fmt.Errorf("%q is not an exported identifier", name)
+	}
+	if declared.has(name) {
+		return fmt.Errorf("%s is declared twice", name)
+	}
+	declared.add(name)
+	return nil
+}
+
+func sameEnums(a, b *token.Enum) bool {
+	if a == b {
+		return true
+	}
+	if a.Flags != b.Flags || a.Prefix != b.Prefix || a.Type != "" && b.Type != "" && a.Type != b.Type || len(a.Values) != len(b.Values) {
+		return false
+	}
+	for i := range a.Values {
+		if *a.Values[i] != *b.Values[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// enumConsts are names of the enum's value constants.
+func (p *printer) enumConsts(enum *token.Enum) []string {
+	names := make([]string, len(enum.Values))
+	for i, v := range enum.Values {
+		names[i] = p.enumConst(enum, v)
+	}
+	return names
+}
+
+func (p *printer) enumConst(enum *token.Enum, v *token.EnumValue) string {
+	if enum.Prefix != "" {
+		return enum.Prefix + v.Name
+	}
+	return enum.Name + v.Name
+}
+
+func (p *printer) hasFlags() bool {
+	for _, enum := range p.enums {
+		if enum.Flags {
+			return true
+		}
+	}
+	return false
+}
+
+// enumCases are values of the enum that switch cases may list,
+// the first of several values with the same number wins,
+// zero values are skipped for flag sets.
+func (p *printer) enumCases(enum *token.Enum) []*token.EnumValue {
+	var values []*token.EnumValue
+	seen := map[int64]bool{}
+	for _, v := range enum.Values {
+		if seen[v.Value] || enum.Flags && v.Value == 0 {
+			continue
+		}
+		seen[v.Value] = true
+		values = append(values, v)
+	}
+	return values
+}
+
+// enumZero is the zero value of the flag set or nil.
+func (p *printer) enumZero(enum *token.Enum) *token.EnumValue {
+	for _, v := range enum.Values {
+		if v.Value == 0 {
+			return v
+		}
+	}
+	return nil
+}
+
+// enumFormat is the expression formatting the receiver in the given base.
+func (p *printer) enumFormat(enum *token.Enum, base int) string {
+	if enumRanges[enum.Type][0] == 0 {
+		return fmt.Sprintf("strconv.FormatUint(uint64(v), %d)", base)
+	}
+	return fmt.Sprintf("strconv.FormatInt(int64(v), %d)", base)
+}
+
+// enumMask is the union of all flags.
+func (p *printer) enumMask(enum *token.Enum) string {
+	values := p.enumCases(enum)
+	if len(values) == 0 {
+		return "0"
+	}
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = p.enumConst(enum, v)
+	}
+	return strings.Join(names, " | ")
+}
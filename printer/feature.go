@@ -0,0 +1,136 @@
+package printer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// Feature is a part of generated code, features are combined with bitwise OR.
+type Feature int
+
+const (
+	// FeatureTypes generates data types only: interface name constants
+	// and signal bodies, they're generated along with any other feature.
+	FeatureTypes Feature = 1 << iota
+
+	// FeatureClient generates client proxies calling methods.
+	FeatureClient
+
+	// FeatureServer generates interfaces that servers implement,
+	// functions exporting them and emitting signals.
+	FeatureServer
+
+	// FeatureSignals generates signal types and their lookup.
+	FeatureSignals
+
+	// FeatureProperties generates property accessors of client proxies,
+	// so it requires FeatureClient.
+	FeatureProperties
+
+	// FeatureMocks generates in-memory mocks, like PrintMocks does,
+	// into the same output as the rest of the code.
+	FeatureMocks
+)
+
+// DefaultFeatures are generated unless WithFeatures is given.
+const DefaultFeatures = FeatureTypes | FeatureClient | FeatureSignals | FeatureProperties
+
+var featureNames = []struct {
+	feature Feature
+	name    string
+}{
+	{FeatureTypes, "types"},
+	{FeatureClient, "client"},
+	{FeatureServer, "server"},
+	{FeatureSignals, "signals"},
+	{FeatureProperties, "properties"},
+	{FeatureMocks, "mocks"},
+}
+
+// ParseFeatures converts feature names into a Feature set, names are
+// types, client, server, signals, properties and mocks,
+// properties cannot be used without client.
+func ParseFeatures(names []string) (Feature, error) {
+	f, err := parseFeatureNames(names)
+	if err != nil {
+		return 0, err
+	}
+	if f&FeatureProperties != 0 && f&FeatureClient == 0 {
+		return 0, fmt.Errorf("feature %q requires %q", "properties", "client")
+	}
+	return f, nil
+}
+
+// parseFeatureNames is ParseFeatures that doesn't check dependencies.
+func parseFeatureNames(names []string) (Feature, error) {
+	var f Feature
+	for _, name := range names {
+		var found bool
+		for _, fn := range featureNames {
+			if fn.name == name {
+				f |= fn.feature
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	return f, nil
+}
+
+// String implements fmt.Stringer.
+func (f Feature) String() string {
+	var names []string
+	for _, fn := range featureNames {
+		if f&fn.feature != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// WithFeatures selects parts of generated code, FeatureTypes is always added,
+// DefaultFeatures are generated by default.
+func WithFeatures(f Feature) PrintOption {
+	return func(p *printer) {
+		p.features = f | FeatureTypes
+	}
+}
+
+// feature reports whether any of the named features is enabled,
+// it's used by templates.
+func (p *printer) feature(names ...string) (bool, error) {
+	f, err := parseFeatureNames(names)
+	if err != nil {
+		return false, err
+	}
+	return p.features&f != 0, nil
+}
+
+// ifaceUsesDBus reports whether code of the interfaces refers to the dbus
+// package, files of PrintFiles import it even when it's not used otherwise.
+func (p *printer) ifaceUsesDBus(ifaces []*token.Interface) bool {
+	if p.features&(FeatureClient|FeatureMocks) != 0 {
+		return true
+	}
+	for _, iface := range ifaces {
+		if p.features&FeatureServer != 0 && len(iface.Methods) != 0 {
+			return true
+		}
+		for _, signal := range iface.Signals {
+			if p.features&(FeatureServer|FeatureSignals) != 0 {
+				return true
+			}
+			for _, arg := range signal.Args {
+				if strings.Contains(p.argType(arg), "dbus.") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package printer
+
+import (
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// WithFiles makes h arguments of methods and signals *os.File.
+//
+// Files passed to methods and emitted with signals stay owned by the caller,
+// generated code keeps them open until the message is sent, files returned
+// by methods, passed to servers and received with signals are owned
+// by the receiver that must close them. Servers return dbus.UnixFD,
+// they never learn when replies are sent, so they keep owning
+// the descriptors. Properties, arrays and structs keep dbus.UnixFD,
+// because the dbus package translates single descriptors of top-level
+// message values only, arrays of them are translated only when received.
+func WithFiles(enable bool) PrintOption {
+	return func(p *printer) {
+		p.files = enable
+	}
+}
+
+// declareFiles finds h arguments of methods and signals that become files.
+func (p *printer) declareFiles(ifaces []*token.Interface) {
+	p.fileArgs = map[*token.Arg]bool{}
+	if !p.files {
+		return
+	}
+	mark := func(args []*token.Arg) {
+		for _, arg := range args {
+			if arg.Type == "dbus.UnixFD" {
+				p.fileArgs[arg] = true
+			}
+		}
+	}
+	for _, iface := range ifaces {
+		for _, method := range iface.Methods {
+			mark(method.In)
+			mark(method.Out)
+		}
+		for _, signal := range iface.Signals {
+			mark(signal.Args)
+		}
+	}
+}
+
+// hasFiles reports whether any argument of the interfaces is a file.
+func (p *printer) hasFiles(ifaces []*token.Interface) bool {
+	return p.hasMethodFiles(ifaces) || p.hasSignalFiles(ifaces)
+}
+
+// hasMethodFiles reports whether any method argument of the interfaces is a file.
+func (p *printer) hasMethodFiles(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		for _, method := range iface.Methods {
+			if p.anyFile(method.In) || p.anyFile(method.Out) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasSignalFiles reports whether any signal argument of the interfaces is a file.
+func (p *printer) hasSignalFiles(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		for _, signal := range iface.Signals {
+			if p.anyFile(signal.Args) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesFileType reports whether code of the interfaces refers to *os.File,
+// signal bodies always do, methods only with clients and mocks,
+// and servers only with file input arguments.
+func (p *printer) usesFileType(ifaces []*token.Interface) bool {
+	if p.hasSignalFiles(ifaces) || p.features&(FeatureClient|FeatureMocks) != 0 && p.hasMethodFiles(ifaces) {
+		return true
+	}
+	if p.features&FeatureServer != 0 {
+		for _, iface := range ifaces {
+			for _, method := range iface.Methods {
+				if p.anyFile(method.In) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (p *printer) hasFileOuts(method *token.Method) bool {
+	return p.anyFile(method.Out)
+}
+
+func (p *printer) anyFile(args []*token.Arg) bool {
+	for _, arg := range args {
+		if p.fileArgs[arg] {
+			return true
+		}
+	}
+	return false
+}
+
+// isFile reports whether the argument is a file, signal decoders
+// start with an invalid descriptor, so failures never wrap stdin.
+func (p *printer) isFile(arg *token.Arg) bool {
+	return p.fileArgs[arg]
+}
+
+// argType is the Go type of the argument in generated signatures,
+// Type of the argument is the one it's sent and received as.
+func (p *printer) argType(arg *token.Arg) string {
+	if p.fileArgs[arg] {
+		return "*os.File"
+	}
+	return arg.Type
+}
+
+// fileVar is the name of the variable a returned file's descriptor is stored to.
+func (p *printer) fileVar(arg *token.Arg) string {
+	return p.fileVars[arg]
+}
+
+// fileWrap converts the received value expression into the argument's Go type.
+func (p *printer) fileWrap(arg *token.Arg, expr string) string {
+	if p.fileArgs[arg] {
+		return "newFile(" + expr + ")"
+	}
+	return expr
+}
+
+// fileUnwrap converts the expression of the argument's Go type into the value to send.
+func (p *printer) fileUnwrap(arg *token.Arg, expr string) string {
+	if p.fileArgs[arg] {
+		return "fileFD(" + expr + ")"
+	}
+	return expr
+}
+
+// mockWrap and mockUnwrap are fileWrap and fileUnwrap of mocks,
+// they duplicate descriptors like sending them does.
+func (p *printer) mockWrap(arg *token.Arg, expr string) string {
+	if p.fileArgs[arg] {
+		return "newFile(mockDup(" + expr + "))"
+	}
+	return expr
+}
+
+func (p *printer) mockUnwrap(arg *token.Arg, expr string) string {
+	if p.fileArgs[arg] {
+		return "mockDupFile(" + expr + ")"
+	}
+	return expr
+}
+
+// keepMethodFiles keeps files passed to the method until it's called,
+// it's empty when the method has no file arguments.
+func (p *printer) keepMethodFiles(method *token.Method) string {
+	return keepFiles(p.fileNames(method.In, ""))
+}
+
+// keepSignalFiles keeps files of the signal body until it's emitted.
+func (p *printer) keepSignalFiles(signal *token.Signal) string {
+	return keepFiles(p.fileNames(signal.Args, "body."))
+}
+
+// fileNames are names of file arguments with the given prefix,
+// signal fields are exported and have the body prefix.
+func (p *printer) fileNames(args []*token.Arg, prefix string) []string {
+	var names []string
+	for i, arg := range args {
+		if !p.fileArgs[arg] {
+			continue
+		}
+		if prefix == "" {
+			names = append(names, p.argName(arg, "in", i, false))
+		} else {
+			names = append(names, prefix+p.argName(arg, "v", i, true))
+		}
+	}
+	return names
+}
+
+func keepFiles(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return "keepFiles(" + strings.Join(names, ", ") + ")"
+}
@@ -0,0 +1,411 @@
+package printer
+
+import (
+	"io"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+const mockTemplate = `
+{{- define "header" -}}
+// Code generated by dbus-codegen-go {{ .Version }}. DO NOT EDIT.
+{{- if .InputHash }}
+// Input: {{ .InputHash }}
+{{- end }}
+
+package {{ .PackageName }}
+{{- end }}
+
+{{- define "main" }}
+{{- template "header" . }}
+
+import (
+	"context"
+{{- if hasFiles .Interfaces }}
+	"os"
+{{- end }}
+	"strings"
+	"sync"
+{{- if hasFiles .Interfaces }}
+	"syscall"
+{{- end }}
+
+	"github.com/godbus/dbus/v5"
+)
+{{ template "mockCommon" . }}
+{{- range $iface := .Interfaces }}
+{{ template "mockIface" $iface }}
+{{- end }}
+{{- end }}
+
+{{- define "commonFile" }}
+{{- template "header" . }}
+
+import (
+	"context"
+{{- if hasFiles .Interfaces }}
+	"os"
+{{- end }}
+	"strings"
+	"sync"
+{{- if hasFiles .Interfaces }}
+	"syscall"
+{{- end }}
+
+	"github.com/godbus/dbus/v5"
+)
+{{ template "mockCommon" . }}
+{{- end }}
+
+{{- define "ifaceFile" }}
+{{- template "header" . }}
+
+import (
+{{- if hasMethodFiles .Interfaces }}
+	"os"
+{{ end }}
+	"github.com/godbus/dbus/v5"
+)
+{{ range $iface := .Interfaces }}
+{{ template "mockIface" $iface }}
+{{- end }}
+{{- end }}`
+
+// mockBodyTemplate declares mocks, it's used by mockTemplate
+// and embedded into srcTemplate with FeatureMocks.
+const mockBodyTemplate = `
+
+{{- define "mockCommon" }}
+// MockCall is a method call recorded by a mock.
+type MockCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// mockObject implements dbus.BusObject on top of the handle function
+// provided by the concrete mock, it also records calls and delivers signals.
+type mockObject struct {
+	mu     sync.Mutex
+	dest   string
+	path   dbus.ObjectPath
+	calls  []MockCall
+	sigcs  []chan<- *dbus.Signal
+	handle func(method string, args []interface{}) ([]interface{}, error)
+}
+
+// Calls returns all method calls made to the mock so far.
+func (m *mockObject) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls := make([]MockCall, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// Signal registers the channel that receives emitted signals,
+// the same way dbus.Conn.Signal does.
+func (m *mockObject) Signal(ch chan<- *dbus.Signal) {
+	m.mu.Lock()
+	m.sigcs = append(m.sigcs, ch)
+	m.mu.Unlock()
+}
+
+// emit delivers the named signal to all registered channels.
+func (m *mockObject) emit(name string, body ...interface{}) {
+	m.mu.Lock()
+	sigcs := make([]chan<- *dbus.Signal, len(m.sigcs))
+	copy(sigcs, m.sigcs)
+	m.mu.Unlock()
+	for _, ch := range sigcs {
+		ch <- &dbus.Signal{
+			Sender: m.dest,
+			Path:   m.path,
+			Name:   name,
+			Body:   body,
+		}
+	}
+}
+
+// Call implements dbus.BusObject.
+func (m *mockObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return m.CallWithContext(context.Background(), method, flags, args...)
+}
+
+// CallWithContext implements dbus.BusObject.
+func (m *mockObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{Method: method, Args: args})
+	m.mu.Unlock()
+
+	call := &dbus.Call{
+		Destination: m.dest,
+		Path:        m.path,
+		Method:      method,
+		Args:        args,
+	}
+	if err := ctx.Err(); err != nil {
+		call.Err = err
+		return call
+	}
+	call.Body, call.Err = m.handle(method, args)
+	return call
+}
+
+// Go implements dbus.BusObject.
+func (m *mockObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return m.GoWithContext(context.Background(), method, flags, ch, args...)
+}
+
+// GoWithContext implements dbus.BusObject.
+func (m *mockObject) GoWithContext(ctx context.Context, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	if ch == nil {
+		ch = make(chan *dbus.Call, 1)
+	}
+	call := m.CallWithContext(ctx, method, flags, args...)
+	call.Done = ch
+	ch <- call
+	return call
+}
+
+// AddMatchSignal implements dbus.BusObject.
+func (m *mockObject) AddMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+// RemoveMatchSignal implements dbus.BusObject.
+func (m *mockObject) RemoveMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+// GetProperty implements dbus.BusObject.
+func (m *mockObject) GetProperty(p string) (dbus.Variant, error) {
+	i := strings.LastIndexByte(p, '.')
+	if i == -1 {
+		return dbus.Variant{}, mockError("org.freedesktop.DBus.Error.UnknownProperty", p)
+	}
+	var v dbus.Variant
+	if err := m.Call(methodPropertyGet, 0, p[:i], p[i+1:]).Store(&v); err != nil {
+		return dbus.Variant{}, err
+	}
+	return v, nil
+}
+
+// SetProperty implements dbus.BusObject.
+func (m *mockObject) SetProperty(p string, v interface{}) error {
+	i := strings.LastIndexByte(p, '.')
+	if i == -1 {
+		return mockError("org.freedesktop.DBus.Error.UnknownProperty", p)
+	}
+	return m.Call(methodPropertySet, 0, p[:i], p[i+1:], v).Store()
+}
+
+// Destination implements dbus.BusObject.
+func (m *mockObject) Destination() string {
+	return m.dest
+}
+
+// Path implements dbus.BusObject.
+func (m *mockObject) Path() dbus.ObjectPath {
+	return m.path
+}
+
+func mockError(name, s string) error {
+	return dbus.NewError(name, []interface{}{s})
+}
+{{- if hasFiles .Interfaces }}
+
+// mockDup duplicates the descriptor like sending it does,
+// so mocks and their clients own different descriptors,
+// it returns an invalid descriptor when that fails.
+func mockDup(fd dbus.UnixFD) dbus.UnixFD {
+	dup, err := syscall.Dup(int(fd))
+	if err != nil {
+		return -1
+	}
+	return dbus.UnixFD(dup)
+}
+
+// mockDupFile duplicates the descriptor of the file.
+func mockDupFile(f *os.File) dbus.UnixFD {
+	fd := mockDup(fileFD(f))
+	keepFiles(f)
+	return fd
+}
+{{- end }}
+{{- end }}
+
+{{- define "mockIface" }}
+{{- $iface := . }}
+// {{ mockNewType $iface }} creates an in-memory {{ $iface.Name }} object,
+// pass it to {{ ifaceNewType $iface }} to get a client backed by the mock.
+func {{ mockNewType $iface }}(dest string, path dbus.ObjectPath) *{{ mockType $iface }} {
+	m := &{{ mockType $iface }}{}
+	m.dest = dest
+	m.path = path
+	m.handle = m.handleCall
+	return m
+}
+
+// {{ mockType $iface }} mocks {{ $iface.Name }} D-Bus interface.
+//
+// Methods return zero values unless the corresponding func is set,
+// properties are served from and stored to Props.
+type {{ mockType $iface }} struct {
+	mockObject
+{{ range $method := $iface.Methods }}
+	// {{ mockFuncName $method }} is called by {{ $iface.Name }}.{{ $method.Name }} method.
+	{{ mockFuncName $method }} func({{ joinArgTypes $method.In }}) ({{ if $method.Out }}{{ joinArgTypes $method.Out }}, {{ end }}error)
+{{- end }}
+{{- if $iface.Properties }}
+
+	// Props holds {{ $iface.Name }} property values.
+	Props struct {
+{{- range $prop := $iface.Properties }}
+		{{ propType $prop }} {{ $prop.Arg.Type }}
+{{- end }}
+	}
+{{- end }}
+}
+{{ range $method := $iface.Methods }}
+// {{ methodType $method }}Returns makes {{ $iface.Name }}.{{ $method.Name }} method return the given values.
+func (m *{{ mockType $iface }}) {{ methodType $method }}Returns(
+{{- range $i, $arg := $method.Out }}out{{ $i }} {{ argType $arg }}, {{ end }}err error) {
+	m.{{ mockFuncName $method }} = func({{ joinArgTypes $method.In }}) ({{ if $method.Out }}{{ joinArgTypes $method.Out }}, {{ end }}error) {
+		return {{ range $i, $arg := $method.Out }}out{{ $i }}, {{ end }}err
+	}
+}
+{{ end }}
+{{- range $signal := $iface.Signals }}
+// {{ mockEmitName $signal }} emits {{ $iface.Name }}.{{ $signal.Name }} signal.
+func (m *{{ mockType $iface }}) {{ mockEmitName $signal }}(body *{{ signalBodyType $iface $signal }}) {
+	m.emit({{ ifaceNameConst $iface }} + "." + "{{ $signal.Name }}"
+{{- range $i, $arg := $signal.Args }}, {{ mockUnwrap $arg (printf "body.%s" (argName $arg "v" $i true)) }}{{ end }})
+}
+{{ end }}
+func (m *{{ mockType $iface }}) handleCall(method string, args []interface{}) ([]interface{}, error) {
+	switch method {
+{{- range $method := $iface.Methods }}
+	case {{ ifaceNameConst $iface }} + "." + "{{ $method.Name }}":
+{{- range $i, $arg := $method.In }}
+		var in{{ $i }} {{ $arg.Type }}
+{{- end }}
+		if err := dbus.Store(args{{ range $i, $arg := $method.In }}, &in{{ $i }}{{ end }}); err != nil {
+			return nil, err
+		}
+{{- range $i, $arg := $method.Out }}
+		var out{{ $i }} {{ argType $arg }}
+{{- end }}
+		var err error
+		if m.{{ mockFuncName $method }} != nil {
+			{{ range $i, $arg := $method.Out }}out{{ $i }}, {{ end }}err = m.{{ mockFuncName $method }}({{ range $i, $arg := $method.In }}{{ if $i }}, {{ end }}{{ mockWrap $arg (printf "in%d" $i) }}{{ end }})
+		}
+		return []interface{}{ {{- range $i, $arg := $method.Out }}{{ if $i }}, {{ end }}{{ mockUnwrap $arg (printf "out%d" $i) }}{{ end -}} }, err
+{{- end }}
+{{- if and $iface.Properties (ne $iface.Name "org.freedesktop.DBus.Properties") }}
+	case methodPropertyGet:
+		var iface, prop string
+		if err := dbus.Store(args, &iface, &prop); err != nil {
+			return nil, err
+		}
+		if iface != {{ ifaceNameConst $iface }} {
+			return nil, mockError("org.freedesktop.DBus.Error.UnknownInterface", iface)
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		switch prop {
+{{- range $prop := $iface.Properties }}
+{{- if $prop.Read }}
+		case "{{ $prop.Name }}":
+			return []interface{}{dbus.MakeVariant(m.Props.{{ propType $prop }})}, nil
+{{- end }}
+{{- end }}
+		default:
+			return nil, mockError("org.freedesktop.DBus.Error.UnknownProperty", prop)
+		}
+	case methodPropertySet:
+		if len(args) != 3 {
+			return nil, mockError("org.freedesktop.DBus.Error.InvalidArgs", method)
+		}
+		var iface, prop string
+		if err := dbus.Store(args[:2], &iface, &prop); err != nil {
+			return nil, err
+		}
+		if iface != {{ ifaceNameConst $iface }} {
+			return nil, mockError("org.freedesktop.DBus.Error.UnknownInterface", iface)
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		switch prop {
+{{- range $prop := $iface.Properties }}
+		case "{{ $prop.Name }}":
+{{- if $prop.Write }}
+			return nil, dbus.Store(args[2:], &m.Props.{{ propType $prop }})
+{{- else }}
+			return nil, mockError("org.freedesktop.DBus.Error.PropertyReadOnly", prop)
+{{- end }}
+{{- end }}
+		default:
+			return nil, mockError("org.freedesktop.DBus.Error.UnknownProperty", prop)
+		}
+{{- if standard }}
+	case methodPropertyGetAll:
+		var iface string
+		if err := dbus.Store(args, &iface); err != nil {
+			return nil, err
+		}
+		if iface != {{ ifaceNameConst $iface }} {
+			return nil, mockError("org.freedesktop.DBus.Error.UnknownInterface", iface)
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return []interface{}{map[string]dbus.Variant{
+{{- range $prop := $iface.Properties }}
+{{- if $prop.Read }}
+			"{{ $prop.Name }}": dbus.MakeVariant(m.Props.{{ propType $prop }}),
+{{- end }}
+{{- end }}
+		}}, nil
+{{- end }}
+{{- end }}
+{{- if and standard (ne $iface.Name "org.freedesktop.DBus.Peer") }}
+	case methodPeerPing:
+		return nil, nil
+{{- end }}
+{{- if and standard (ne $iface.Name "org.freedesktop.DBus.Introspectable") }}
+	case methodIntrospect:
+		return []interface{}{"<node><interface name=\"" + {{ ifaceNameConst $iface }} + "\"></interface></node>"}, nil
+{{- end }}
+	default:
+		return nil, mockError("org.freedesktop.DBus.Error.UnknownMethod", method)
+	}
+}
+{{- end }}`
+
+// PrintMocks generates in-memory mocks for the provided interfaces and writes them to out.
+//
+// Mocks implement dbus.BusObject, so they're meant to be passed to constructors
+// of client code generated by Print with the same options into the same package.
+func PrintMocks(out io.Writer, ifaces []*token.Interface, opts ...PrintOption) error {
+	return execute(out, mockTemplate, ifaces, opts)
+}
+
+// PrintMockFiles is PrintFiles for mocks, file names have _mock suffix.
+func PrintMockFiles(ifaces []*token.Interface, opts ...PrintOption) (map[string][]byte, error) {
+	return executeFiles(mockTemplate, "mock", ifaces, opts)
+}
+
+func (p *printer) mockType(iface *token.Interface) string {
+	return "Mock" + p.ifaceType(iface)
+}
+
+func (p *printer) mockNewType(iface *token.Interface) string {
+	return "New" + p.mockType(iface)
+}
+
+func (p *printer) mockFuncName(method *token.Method) string {
+	return p.methodType(method) + "Func"
+}
+
+func (p *printer) mockEmitName(signal *token.Signal) string {
+	return "Emit" + p.signalName(signal)
+}
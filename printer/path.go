@@ -0,0 +1,236 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// pathTemplate is a parsed token.Interface.PathTemplate.
+type pathTemplate struct {
+	Source string
+	Elems  []*pathElem
+	Args   []*token.Arg // placeholders in order of appearance
+
+	// identifiers of builder, parser and bound constructor bodies
+	Conn  string
+	Path  string
+	Split string
+}
+
+// pathElem is an element of the template, literal ones have no Arg.
+type pathElem struct {
+	Prefix string
+	Suffix string
+	Arg    *token.Arg
+	Escape bool
+}
+
+// parsePathTemplate parses a path template where every element
+// contains at most one {name} or {name:escape} placeholder.
+func parsePathTemplate(s string) (*pathTemplate, error) {
+	if !strings.HasPrefix(s, "/") || s == "/" {
+		return nil, fmt.Errorf("path template %q is not absolute", s)
+	}
+	t := &pathTemplate{Source: s}
+	for _, elem := range strings.Split(s[1:], "/") {
+		e := &pathElem{Prefix: elem}
+		if i := strings.IndexByte(elem, '{'); i != -1 {
+			j := strings.IndexByte(elem, '}')
+			if j < i {
+				return nil, fmt.Errorf("path template %q: unclosed placeholder in %q", s, elem)
+			}
+			name := elem[i+1 : j]
+			if k := strings.IndexByte(name, ':'); k != -1 {
+				if name[k+1:] != "escape" {
+					return nil, fmt.Errorf("path template %q: unknown placeholder modifier %q", s, name[k+1:])
+				}
+				name, e.Escape = name[:k], true
+			}
+			if !identRegexp.MatchString(name) {
+				return nil, fmt.Errorf("path template %q: invalid placeholder name %q", s, name)
+			}
+			for _, arg := range t.Args {
+				if arg.Name == name {
+					return nil, fmt.Errorf("path template %q: duplicate placeholder %q", s, name)
+				}
+			}
+			e.Prefix, e.Suffix = elem[:i], elem[j+1:]
+			e.Arg = &token.Arg{Name: name, Type: "string"}
+			t.Args = append(t.Args, e.Arg)
+		}
+		if e.Arg == nil && elem == "" {
+			return nil, fmt.Errorf("path template %q has an empty element", s)
+		}
+		for _, part := range []string{e.Prefix, e.Suffix} {
+			for _, c := range part {
+				if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+					return nil, fmt.Errorf("path template %q: invalid character %q", s, c)
+				}
+			}
+		}
+		t.Elems = append(t.Elems, e)
+	}
+	if len(t.Args) == 0 {
+		return nil, fmt.Errorf("path template %q has no placeholders", s)
+	}
+	return t, nil
+}
+
+// parsePathTemplates parses path templates of the interfaces.
+func (p *printer) parsePathTemplates(ifaces []*token.Interface) error {
+	p.pathTemplates = map[*token.Interface]*pathTemplate{}
+	for _, iface := range ifaces {
+		if iface.PathTemplate == "" {
+			continue
+		}
+		t, err := parsePathTemplate(iface.PathTemplate)
+		if err != nil {
+			return fmt.Errorf("%s: %s", iface.Name, err)
+		}
+		p.pathTemplates[iface] = t
+	}
+	return nil
+}
+
+// pathTemplate returns the path template of the interface or nil.
+func (p *printer) pathTemplate(iface *token.Interface) *pathTemplate {
+	return p.pathTemplates[iface]
+}
+
+func (p *printer) hasPathTemplates(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		if p.pathTemplates[iface] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) hasEscapes(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		if t := p.pathTemplates[iface]; t != nil {
+			for _, e := range t.Elems {
+				if e.Escape {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (p *printer) pathParseFunc(iface *token.Interface) string {
+	return "ParsePath" + p.ifaceType(iface)
+}
+
+// joinPathArgs is a list of arguments of the path builder.
+func (p *printer) joinPathArgs(t *pathTemplate) string {
+	var buf strings.Builder
+	for i, arg := range t.Args {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(p.argNames[arg] + " string")
+	}
+	return buf.String()
+}
+
+// joinPathArgNames is joinArgNames of the path builder.
+func (p *printer) joinPathArgNames(t *pathTemplate) string {
+	names := make([]string, len(t.Args))
+	for i, arg := range t.Args {
+		names[i] = p.argNames[arg]
+	}
+	return strings.Join(names, ", ")
+}
+
+// pathExpr is the expression building the path of the template's values.
+func (p *printer) pathExpr(t *pathTemplate) string {
+	var parts []string
+	var lit strings.Builder
+	for _, e := range t.Elems {
+		lit.WriteString("/" + e.Prefix)
+		if e.Arg == nil {
+			continue
+		}
+		if lit.Len() != 0 {
+			parts = append(parts, strconv.Quote(lit.String()))
+			lit.Reset()
+		}
+		if e.Escape {
+			parts = append(parts, "escapePathLabel("+p.argNames[e.Arg]+")")
+		} else {
+			parts = append(parts, p.argNames[e.Arg])
+		}
+		lit.WriteString(e.Suffix)
+	}
+	if lit.Len() != 0 {
+		parts = append(parts, strconv.Quote(lit.String()))
+	}
+	return "dbus.ObjectPath(" + strings.Join(parts, " + ") + ")"
+}
+
+// pathMismatch is the condition that's true when
+// elements of a split path don't match the template.
+func (p *printer) pathMismatch(t *pathTemplate) string {
+	conds := []string{
+		fmt.Sprintf("len(%s) != %d", t.Split, len(t.Elems)+1),
+		t.Split + `[0] != ""`,
+	}
+	for i, e := range t.Elems {
+		elem := fmt.Sprintf("%s[%d]", t.Split, i+1)
+		if e.Arg == nil {
+			conds = append(conds, elem+" != "+strconv.Quote(e.Prefix))
+			continue
+		}
+		if e.Prefix != "" && e.Suffix != "" {
+			conds = append(conds, fmt.Sprintf("len(%s) < %d", elem, len(e.Prefix)+len(e.Suffix)))
+		}
+		if e.Prefix != "" {
+			conds = append(conds, "!strings.HasPrefix("+elem+", "+strconv.Quote(e.Prefix)+")")
+		}
+		if e.Suffix != "" {
+			conds = append(conds, "!strings.HasSuffix("+elem+", "+strconv.Quote(e.Suffix)+")")
+		}
+	}
+	return strings.Join(conds, " || ")
+}
+
+// pathValue is the expression extracting the value of the placeholder from the split path.
+func (p *printer) pathValue(t *pathTemplate, e *pathElem) string {
+	for i := range t.Elems {
+		if t.Elems[i] != e {
+			continue
+		}
+		elem := fmt.Sprintf("%s[%d]", t.Split, i+1)
+		switch {
+		case e.Suffix == "" && e.Prefix == "":
+			return elem
+		case e.Suffix == "":
+			return fmt.Sprintf("%s[%d:]", elem, len(e.Prefix))
+		default:
+			return fmt.Sprintf("%s[%d:len(%s)-%d]", elem, len(e.Prefix), elem, len(e.Suffix))
+		}
+	}
+	panic("element doesn't belong to the template")
+}
+
+// declarePathTemplate declares identifiers of the template's
+// builder, parser and bound constructor.
+func (p *printer) declarePathTemplate(iface *token.Interface) {
+	t := p.pathTemplates[iface]
+	if t == nil {
+		return
+	}
+	where := iface.Name + " path template"
+	args := newScope(reservedArgIdents...)
+	for i, arg := range t.Args {
+		p.argNames[arg] = p.declare(args, where, p.argIdent(arg, "v", i, false), single)
+	}
+	t.Conn = p.declare(args, where, "conn", single)
+	t.Path = p.declare(args, where, "path", single)
+	t.Split = p.declare(args, where, "elems", single)
+}
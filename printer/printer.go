@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/tq-systems/go-dbus-codegen/token"
 )
@@ -20,9 +21,36 @@ import (
 type PrintOption func(p *printer)
 
 type printer struct {
-	pkgName  string
-	gofmt    bool
-	prefixes []string
+	pkgName     string
+	gofmt       bool
+	prefixes    []string
+	style       NamingStyle
+	initialisms map[string]bool
+	renames     []*RenameRule
+	inputHash   string
+	runtime     bool
+	standard    bool
+	features    Feature
+	conflictFn  func(c Conflict)
+
+	// identifiers assigned by resolve
+	ifaceTypes    map[*token.Interface]string
+	methodTypes   map[*token.Method]string
+	propTypes     map[*token.Property]string
+	signalTypes   map[*token.Signal]string
+	propsTypes    map[*token.Interface]string
+	argNames      map[*token.Arg]string
+	refHelpers    map[interface{}]*refHelper // by *token.Method or *token.Property
+	busConsts     map[string]string
+	pathTemplates map[*token.Interface]*pathTemplate
+	buses         []string // bus names in order of appearance
+	enums         []*token.Enum
+	files         bool
+	fileArgs      map[*token.Arg]bool
+	fileVars      map[*token.Arg]string
+	types         []*token.Type
+
+	ifaceNames map[string]*token.Interface
 }
 
 // WithPackageName overrides the package name of generated code.
@@ -50,9 +78,94 @@ func WithPrefixes(prefixes []string) PrintOption {
 	}
 }
 
+// WithRuntime makes generated code depend on the rt package instead of
+// declaring common types itself, interfaces and signals are registered in it,
+// so several generated packages in one binary share signal dispatch.
+func WithRuntime(enable bool) PrintOption {
+	return func(p *printer) {
+		p.runtime = enable
+	}
+}
+
+// WithStandard makes generated proxies expose Ping, Introspect and
+// GetProperties helpers of standard interfaces, see parser.StandardXML,
+// helpers that clash with members of an interface are not generated.
+func WithStandard(enable bool) PrintOption {
+	return func(p *printer) {
+		p.standard = enable
+	}
+}
+
+// Version is the generator version written to headers of generated files.
+const Version = "v0.2.0"
+
+// WithInputHash adds the hash of input documents to headers of generated files,
+// so it's possible to find out what the code was generated from.
+func WithInputHash(hash string) PrintOption {
+	return func(p *printer) {
+		p.inputHash = hash
+	}
+}
+
+// NamingStyle is a way of joining D-Bus name parts into Go type names.
+type NamingStyle int
+
+const (
+	// UglyCase separates name parts with underscores: Org_Freedesktop_DBus.
+	UglyCase NamingStyle = iota
+
+	// CamelCase concatenates name parts: OrgFreedesktopDBus.
+	CamelCase
+)
+
+// String implements fmt.Stringer.
+func (s NamingStyle) String() string {
+	switch s {
+	case UglyCase:
+		return "ugly"
+	case CamelCase:
+		return "camel"
+	default:
+		return "NamingStyle(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// WithNamingStyle sets the naming style of interface, signal and signal body types,
+// UglyCase is used by default.
+func WithNamingStyle(style NamingStyle) PrintOption {
+	return func(p *printer) {
+		p.style = style
+	}
+}
+
+// DefaultInitialisms is the list of initialisms used by golint,
+// words matching them are upper-cased in generated identifiers.
+var DefaultInitialisms = []string{
+	"ACL", "API", "ASCII", "CPU", "CSS", "DNS", "EOF", "GUID", "HTML", "HTTP",
+	"HTTPS", "ID", "IP", "JSON", "LHS", "QPS", "RAM", "RHS", "RPC", "SLA",
+	"SMTP", "SQL", "SSH", "TCP", "TLS", "TTL", "UDP", "UI", "UID", "UUID",
+	"URI", "URL", "UTF8", "VM", "XML", "XMPP", "XSRF", "XSS",
+}
+
+// WithInitialisms overrides the list of initialisms, so GetId becomes GetID,
+// DefaultInitialisms are used unless it's given, empty list disables it.
+func WithInitialisms(initialisms []string) PrintOption {
+	return func(p *printer) {
+		p.initialisms = make(map[string]bool, len(initialisms))
+		for _, s := range initialisms {
+			p.initialisms[strings.ToUpper(s)] = true
+		}
+	}
+}
+
 var identRegexp = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_]*$")
 
-const srcTemplate = `// Code generated by dbus-codegen-go. DO NOT EDIT.
+const srcTemplate = `
+{{- define "header" -}}
+// Code generated by dbus-codegen-go {{ .Version }}. DO NOT EDIT.
+{{- if .InputHash }}
+// Input: {{ .InputHash }}
+{{- end }}
 //
 {{- range $iface := .Interfaces }}
 // {{ $iface.Name }}
@@ -77,20 +190,166 @@ const srcTemplate = `// Code generated by dbus-codegen-go. DO NOT EDIT.
 //
 {{- end }}
 package {{ .PackageName }}
+{{- end }}
+
+{{- define "main" }}
+{{- template "header" . }}
+
+{{ template "imports" . }}
+{{ template "common" . }}
+{{- range $iface := .Interfaces }}
+{{ template "iface" $iface }}
+{{- end }}
+{{- end }}
+
+{{- define "commonFile" }}
+{{- template "header" . }}
+
+{{ template "imports" . }}
+{{ template "common" . }}
+{{- end }}
+
+{{- define "ifaceFile" }}
+{{- template "header" . }}
+
+import (
+{{- if usesFileType .Interfaces }}
+	"os"
+{{ end }}
+	"github.com/godbus/dbus/v5"
+)
+{{- if not (ifaceUsesDBus .Interfaces) }}
+
+// Avoid error caused by unused dbus import
+var _ = dbus.Store
+{{- end }}
+{{ range $iface := .Interfaces }}
+{{ template "iface" $iface }}
+{{- end }}
+{{- end }}
 
+{{- define "imports" -}}
 import (
+{{- if feature "mocks" }}
+	"context"
+{{- end }}
+{{- if hasPathTemplates .Interfaces }}
+	"fmt"
+{{- end }}
 	"log"
+{{- if hasFiles .Interfaces }}
+	"os"
+{{- end }}
+{{- if and (hasFiles .Interfaces) (not .Runtime) }}
+	"runtime"
+{{- end }}
+{{- if enums }}
+	"strconv"
+{{- end }}
+{{- if or (feature "mocks") (hasPathTemplates .Interfaces) hasFlags }}
+	"strings"
+{{- end }}
+{{- if feature "mocks" }}
+	"sync"
+{{- end }}
+{{- if and (hasFiles .Interfaces) (feature "mocks") }}
+	"syscall"
+{{- end }}
 
 	"github.com/godbus/dbus/v5"
+{{- if .Runtime }}
+	"github.com/tq-systems/go-dbus-codegen/rt"
+{{- end }}
 )
+{{- end }}
+
+{{- define "dbusUsed" }}
+{{- if not (feature "client" "server" "signals" "mocks") }}
 
+// Avoid error caused by unused dbus import
+var _ = dbus.Store
+{{- end }}
+{{- end }}
+
+{{- define "common" }}
+{{- if .Runtime }}
+const (
+	methodPropertyGet = rt.MethodPropertyGet
+	methodPropertySet = rt.MethodPropertySet
+{{- if .Standard }}
+	methodPropertyGetAll = rt.MethodPropertyGetAll
+	methodPeerPing = rt.MethodPeerPing
+	methodIntrospect = rt.MethodIntrospect
+{{- end }}
+)
+
+// Avoid error caused by unused log import
+var _ = log.Printf
+{{- if feature "client" }}
+
+// Interface is a DBus interface implementation.
+type Interface = rt.Interface
+{{- end }}
+{{- if feature "signals" }}
+
+// Signal is a common interface for all signals.
+type Signal = rt.Signal
+{{- end }}
+{{- if feature "client" }}
+
+// LookupInterface returns an interface for the named object,
+// interfaces of all packages registered in rt are looked up.
+func LookupInterface(object dbus.BusObject, iface string) Interface {
+	return rt.LookupInterface(object, iface)
+}
+{{- end }}
+{{- if feature "signals" }}
+
+// LookupSignal converts the given raw DBus signal into typed one or returns nil,
+// signals of all packages registered in rt are looked up.
+func LookupSignal(signal *dbus.Signal) Signal {
+	return rt.LookupSignal(signal)
+}
+
+// AddMatchRule returns AddMatch rule for the given signal.
+func AddMatchRule(sig Signal) string {
+	return rt.AddMatchRule(sig)
+}
+{{- end }}
+{{- if feature "client" "signals" }}
+
+// init registers interfaces and signals of the package in rt.
+func init() {
+{{- range $iface := .Interfaces }}
+{{- if feature "client" }}
+	rt.RegisterInterface({{ ifaceNameConst $iface }}, func(object dbus.BusObject) rt.Interface {
+		return {{ ifaceNewType $iface }}(object)
+	})
+{{- end }}
+{{- if feature "signals" }}
+{{- range $signal := $iface.Signals }}
+	rt.RegisterSignal({{ ifaceNameConst $iface }}, "{{ $signal.Name }}", func(signal *dbus.Signal) rt.Signal {
+{{- template "decodeSignal" (pair $ $iface $signal) }}
+	})
+{{- end }}
+{{- end }}
+{{- end }}
+}
+{{- end }}
+{{- else }}
 const (
 	methodPropertyGet = "org.freedesktop.DBus.Properties.Get"
 	methodPropertySet = "org.freedesktop.DBus.Properties.Set"
+{{- if .Standard }}
+	methodPropertyGetAll = "org.freedesktop.DBus.Properties.GetAll"
+	methodPeerPing = "org.freedesktop.DBus.Peer.Ping"
+	methodIntrospect = "org.freedesktop.DBus.Introspectable.Introspect"
+{{- end }}
 )
 
 // Avoid error caused by unused log import
 var _ = log.Printf
+{{- if feature "client" }}
 
 // Interface is a DBus interface implementation.
 type Interface interface {
@@ -108,6 +367,8 @@ func LookupInterface(object dbus.BusObject, iface string) Interface {
 		return nil
 	}
 }
+{{- end }}
+{{- if feature "signals" }}
 
 // Signal is a common interface for all signals.
 type Signal interface {
@@ -123,21 +384,7 @@ func LookupSignal(signal *dbus.Signal) Signal {
 {{- range $iface := .Interfaces }}
 {{- range $signal := $iface.Signals }}
 	case {{ ifaceNameConst $iface }} + "." + "{{ $signal.Name }}":
-{{- range $i, $argument := $signal.Args }}
-		v{{ $i }}, ok := signal.Body[{{ $i }}].({{ $argument.Type }})
-		if !ok {
-			log.Printf("[{{ $.PackageName }}] {{ argName $argument "v" $i true }} is %T, not {{ $argument.Type }}", signal.Body[{{ $i }}])
-		}
-{{- end }}
-		return &{{ signalType $iface $signal }}{
-			sender: signal.Sender,
-			path:   signal.Path,
-			Body: {{ signalBodyType $iface $signal }}{
-{{- range $i, $argument := $signal.Args }}
-				{{ argName $argument "v" $i true }}: v{{ $i }},
-{{- end }}
-			},
-		}
+{{- template "decodeSignal" (pair $ $iface $signal) }}
 {{- end }}
 {{- end }}
 	default:
@@ -149,6 +396,16 @@ func LookupSignal(signal *dbus.Signal) Signal {
 func AddMatchRule(sig Signal) string {
 	return "type='signal',interface='" + sig.Interface() + "',member='" + sig.Name() + "'"
 }
+{{- end }}
+{{- end }}
+{{- if and (feature "client") (hasRefHelpers .Interfaces) }}
+
+// Conn creates objects that proxies refer to, *dbus.Conn implements it.
+type Conn interface {
+	Object(dest string, path dbus.ObjectPath) dbus.BusObject
+}
+{{- end }}
+{{- template "dbusUsed" }}
 
 // Interface name constants.
 const (
@@ -156,16 +413,368 @@ const (
 	{{ ifaceNameConst $iface }} = "{{ $iface.Name }}"
 {{- end }}
 )
+{{- if buses }}
+
+// Bus name constants.
+const (
+{{- range $dest := buses }}
+	{{ busConst $dest }} = "{{ $dest }}"
+{{- end }}
+)
+{{- end }}
+{{- if hasPaths .Interfaces }}
+
+// Object path constants of interfaces found at a single path.
+const (
+{{- range $iface := .Interfaces }}
+{{- with ifacePath $iface }}
+	{{ pathConst $iface }} = dbus.ObjectPath("{{ . }}")
+{{- end }}
+{{- end }}
+)
+{{- end }}
+{{- range $iface := .Interfaces }}
+{{- with pathTemplate $iface }}
+
+// {{ pathConst $iface }} returns the path of a {{ $iface.Name }} object, {{ .Source }}.
+func {{ pathConst $iface }}({{ joinPathArgs . }}) dbus.ObjectPath {
+	return {{ pathExpr . }}
+}
+
+// {{ pathParseFunc $iface }} extracts values of a {{ $iface.Name }} object path, {{ .Source }}.
+func {{ pathParseFunc $iface }}({{ .Path }} dbus.ObjectPath) ({{ joinPathArgs . }}, err error) {
+	{{ .Split }} := strings.Split(string({{ .Path }}), "/")
+	if {{ pathMismatch . }} {
+		err = fmt.Errorf("%s doesn't match {{ .Source }}", {{ .Path }})
+		return
+	}
+{{- $t := . }}
+{{- range $e := .Elems }}
+{{- if $e.Arg }}
+{{- if $e.Escape }}
+	if {{ argName $e.Arg "v" 0 false }}, err = unescapePathLabel({{ pathValue $t $e }}); err != nil {
+		return
+	}
+{{- else }}
+	{{ argName $e.Arg "v" 0 false }} = {{ pathValue $t $e }}
+{{- end }}
+{{- end }}
+{{- end }}
+	return
+}
+{{- end }}
+{{- end }}
+{{- if hasEscapes .Interfaces }}
+{{- if .Runtime }}
+
+// Path label escaping used by path builders and parsers.
+var (
+	escapePathLabel   = rt.EscapePathLabel
+	unescapePathLabel = rt.UnescapePathLabel
+)
+{{- else }}
+
+// escapePathLabel escapes the string to be used as an object path element
+// the way systemd does: bytes other than ASCII letters and non-leading digits
+// are replaced with an underscore followed by two lowercase hex digits,
+// the empty string becomes a single underscore.
+func escapePathLabel(s string) string {
+	if s == "" {
+		return "_"
+	}
+	const hex = "0123456789abcdef"
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			b = append(b, c)
+		} else {
+			b = append(b, '_', hex[c>>4], hex[c&15])
+		}
+	}
+	return string(b)
+}
+
+// unescapePathLabel reverses escapePathLabel.
+func unescapePathLabel(s string) (string, error) {
+	if s == "_" {
+		return "", nil
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("truncated escape sequence in %s", s)
+		}
+		var c byte
+		for _, h := range []byte{s[i+1], s[i+2]} {
+			switch {
+			case h >= '0' && h <= '9':
+				c = c<<4 | (h - '0')
+			case h >= 'a' && h <= 'f':
+				c = c<<4 | (h - 'a' + 10)
+			case h >= 'A' && h <= 'F':
+				c = c<<4 | (h - 'A' + 10)
+			default:
+				return "", fmt.Errorf("invalid escape sequence in %s", s)
+			}
+		}
+		b = append(b, c)
+		i += 2
+	}
+	return string(b), nil
+}
+{{- end }}
+{{- end }}
+{{- if hasFiles .Interfaces }}
+{{- if .Runtime }}
+
+// Descriptor conversions of *os.File arguments.
+var (
+	fileFD    func(f *os.File) dbus.UnixFD = rt.FileFD
+	keepFiles func(files ...*os.File)      = rt.KeepFiles
+	newFile   func(fd dbus.UnixFD) *os.File = rt.NewFile
+)
+{{- else }}
+
+// fileFD returns the descriptor of the file to be sent in a D-Bus message,
+// the caller keeps owning the file that must stay open until it's sent.
+func fileFD(f *os.File) dbus.UnixFD {
+	return dbus.UnixFD(f.Fd())
+}
+
+// keepFiles keeps the files from being closed by finalizers
+// until a message referring to their descriptors is sent.
+func keepFiles(files ...*os.File) {
+	runtime.KeepAlive(files)
+}
+
+// newFile wraps a received descriptor into a file the receiver owns
+// and must close, it returns nil when the descriptor is invalid.
+func newFile(fd dbus.UnixFD) *os.File {
+	return os.NewFile(uintptr(fd), "unixfd")
+}
+{{- end }}
+{{- end }}
+{{- range $enum := enums }}
+{{- $cases := enumCases $enum }}
+
+// {{ $enum.Name }} is {{ if $enum.Flags }}a set of flags{{ else }}an enum{{ end }} of {{ $enum.Type }} values.
+type {{ $enum.Name }} {{ $enum.Type }}
+{{- if $enum.Values }}
+
+// {{ $enum.Name }} values.
+const (
+{{- range $v := $enum.Values }}
+	{{ enumConst $enum $v }} {{ $enum.Name }} = {{ $v.Value }}
+{{- end }}
+)
+{{- end }}
+{{- if $enum.Flags }}
+
+// String implements fmt.Stringer, it joins names of set flags with |.
+func (v {{ $enum.Name }}) String() string {
+	if v == 0 {
+		return "{{ with enumZero $enum }}{{ .Name }}{{ else }}0{{ end }}"
+	}
+	var names []string
+{{- range $v := $cases }}
+	if v&{{ enumConst $enum $v }} == {{ enumConst $enum $v }} {
+		names = append(names, "{{ $v.Name }}")
+		v &^= {{ enumConst $enum $v }}
+	}
+{{- end }}
+	if v != 0 {
+		names = append(names, "0x"+{{ enumFormat $enum 16 }})
+	}
+	return strings.Join(names, "|")
+}
+
+// IsValid reports whether v consists of known flags only.
+func (v {{ $enum.Name }}) IsValid() bool {
+	return v&^({{ enumMask $enum }}) == 0
+}
+{{- else }}
+
+// String implements fmt.Stringer.
+func (v {{ $enum.Name }}) String() string {
+{{- if $cases }}
+	switch v {
+{{- range $v := $cases }}
+	case {{ enumConst $enum $v }}:
+		return "{{ $v.Name }}"
+{{- end }}
+	}
+{{- end }}
+	return "{{ $enum.Name }}(" + {{ enumFormat $enum 10 }} + ")"
+}
+
+// IsValid reports whether v is a known {{ $enum.Name }} value.
+func (v {{ $enum.Name }}) IsValid() bool {
+{{- if $cases }}
+	switch v {
+	case {{ range $i, $v := $cases }}{{ if $i }}, {{ end }}{{ enumConst $enum $v }}{{ end }}:
+		return true
+	}
+{{- end }}
+	return false
+}
+{{- end }}
+{{- end }}
+{{- range $t := types }}
+
+// {{ $t.Name }} is a D-Bus {{ if $t.Fields }}struct{{ else }}value{{ end }} of {{ $t.Sig }} signature.
+{{- if $t.Fields }}
+type {{ $t.Name }} struct {
+{{- range $field := $t.Fields }}
+	{{ $field.Name }} {{ $field.Type }}
+{{- end }}
+}
+{{- else }}
+type {{ $t.Name }} {{ $t.Type }}
+{{- end }}
+{{- end }}
+{{- if feature "server" }}
+{{- template "serverCommon" . }}
+{{- end }}
+{{- if feature "mocks" }}
+{{ template "mockCommon" . }}
+{{- end }}
+{{- end }}
+{{- define "fileVars" }}
+{{- range $arg := .Out }}
+{{- with fileVar $arg }}
+	var {{ . }} dbus.UnixFD
+{{- end }}
+{{- end }}
+{{- end }}
+{{- define "newFiles" }}
+{{- range $i, $arg := .Out }}
+{{- with fileVar $arg }}
+	{{ argName $arg "out" $i false }} = newFile({{ . }})
+{{- end }}
+{{- end }}
+{{- end }}
+{{- define "decodeSignal" }}
+{{- $iface := .Iface }}
+{{- $signal := .Signal }}
+{{- range $i, $argument := $signal.Args }}
+		var v{{ $i }} {{ $argument.Type }}{{ if isFile $argument }} = -1{{ end }}
+		if err := dbus.Store(signal.Body[{{ $i }}:{{ inc $i }}], &v{{ $i }}); err != nil {
+			log.Printf("[{{ $.Ctx.PackageName }}] {{ argName $argument "v" $i true }} is %T, not {{ $argument.Type }}", signal.Body[{{ $i }}])
+		}
+{{- end }}
+		return &{{ signalType $iface $signal }}{
+			sender: signal.Sender,
+			path:   signal.Path,
+			Body: {{ signalBodyType $iface $signal }}{
+{{- range $i, $argument := $signal.Args }}
+				{{ argName $argument "v" $i true }}: {{ fileWrap $argument (printf "v%d" $i) }},
+{{- end }}
+			},
+		}
+{{- end }}
+{{- define "standard" }}
+{{- $iface := . }}
+{{- if helperNeeded $iface "Ping" }}
+// Ping calls org.freedesktop.DBus.Peer.Ping method on the object.
+func (o *{{ ifaceType $iface }}) Ping() error {
+	return o.object.Call(methodPeerPing, 0).Store()
+}
+{{ end }}
+{{- if helperNeeded $iface "Introspect" }}
+// Introspect calls org.freedesktop.DBus.Introspectable.Introspect method on the object.
+func (o *{{ ifaceType $iface }}) Introspect() (xmlData string, err error) {
+	err = o.object.Call(methodIntrospect, 0).Store(&xmlData)
+	return
+}
+{{ end }}
+{{- if and (feature "properties") (readableProps $iface) }}
+// {{ propsType $iface }} contains readable {{ $iface.Name }} properties.
+type {{ propsType $iface }} struct {
+{{- range $prop := $iface.Properties }}
+{{- if $prop.Read }}
+	{{ propType $prop }} {{ $prop.Arg.Type }}
+{{- end }}
+{{- end }}
+}
+{{ if helperNeeded $iface "GetProperties" }}
+// GetProperties gets all {{ $iface.Name }} properties at once.
+func (o *{{ ifaceType $iface }}) GetProperties() (*{{ propsType $iface }}, error) {
+	var changed map[string]dbus.Variant
+	if err := o.object.Call(methodPropertyGetAll, 0, {{ ifaceNameConst $iface }}).Store(&changed); err != nil {
+		return nil, err
+	}
+	props := &{{ propsType $iface }}{}
+{{- template "storeProps" (store $iface "nil, ") }}
+	return props, nil
+}
+{{ end }}
+{{- if helperNeeded $iface "UpdateProperties" }}
+// UpdateProperties stores changed {{ $iface.Name }} properties to props,
+// e.g. ones of org.freedesktop.DBus.Properties.PropertiesChanged signal.
+func (o *{{ ifaceType $iface }}) UpdateProperties(props *{{ propsType $iface }}, changed map[string]dbus.Variant) error {
+{{- template "storeProps" (store $iface "") }}
+	return nil
+}
+{{ end }}
+{{- end }}
+{{- end }}
+{{- define "storeProps" }}
+	for name, v := range changed {
+		switch name {
+{{- range $prop := .Iface.Properties }}
+{{- if $prop.Read }}
+		case "{{ $prop.Name }}":
+			if err := dbus.Store([]interface{}{v}, &props.{{ propType $prop }}); err != nil {
+				return {{ $.Results }}err
+			}
+{{- end }}
+{{- end }}
+		}
+	}
+{{- end }}
+{{- define "refProxy" }}
+{{- if isRefSlice .Arg }}
+	{{ .Name }} = make({{ refType .Arg }}, len({{ .Path }}))
+	for {{ .Helper.Index }} := range {{ .Path }} {
+		{{ .Name }}[{{ .Helper.Index }}] = {{ ifaceNewType (refIface .Arg) }}({{ .Helper.Conn }}.Object(o.object.Destination(), {{ .Path }}[{{ .Helper.Index }}]))
+	}
+{{- else }}
+	{{ .Name }} = {{ ifaceNewType (refIface .Arg) }}({{ .Helper.Conn }}.Object(o.object.Destination(), {{ .Path }}))
+{{- end }}
+{{- end }}
 {{- define "annotations" }}
 {{- range $annotation := .Annotations -}}
 // @{{ $annotation.Name }} = {{ $annotation.Value }}
 {{- end }}
 {{- end }}
-{{ range $iface := .Interfaces }}
+
+{{- define "iface" }}
+{{- $iface := . }}
+{{- if feature "client" }}
 // {{ ifaceNewType $iface }} creates and allocates {{ $iface.Name }}.
 func {{ ifaceNewType $iface }}(object dbus.BusObject) *{{ ifaceType $iface }} {
 	return &{{ ifaceType $iface }}{object}
 }
+{{- with boundDest $iface }}
+{{- with pathTemplate $iface }}
+
+// {{ bindFunc $iface }} creates {{ $iface.Name }} of the {{ busConst (boundDest $iface) }} object at {{ pathConst $iface }}({{ joinPathArgNames . }}).
+func {{ bindFunc $iface }}({{ .Conn }} *dbus.Conn, {{ joinPathArgs . }}) *{{ ifaceType $iface }} {
+	return {{ ifaceNewType $iface }}({{ .Conn }}.Object({{ busConst (boundDest $iface) }}, {{ pathConst $iface }}({{ joinPathArgNames . }})))
+}
+{{- else }}
+
+// {{ bindFunc $iface }} creates {{ $iface.Name }} of the {{ busConst . }} object at {{ pathConst $iface }}.
+func {{ bindFunc $iface }}(conn *dbus.Conn) *{{ ifaceType $iface }} {
+	return {{ ifaceNewType $iface }}(conn.Object({{ busConst . }}, {{ pathConst $iface }}))
+}
+{{- end }}
+{{- end }}
 
 // {{ ifaceType $iface }} implements {{ $iface.Name }} D-Bus interface.
 {{- template "annotations" $iface }}
@@ -173,18 +782,62 @@ type {{ ifaceType $iface }} struct {
 	object dbus.BusObject
 }
 
+{{- if runtime }}
+// Interface returns the D-Bus interface name, implements rt.Interface.
+func (o *{{ ifaceType $iface }}) Interface() string {
+{{- else }}
 // iface implements the Interface interface.
 func (o *{{ ifaceType $iface }}) iface() string {
+{{- end }}
 	return {{ ifaceNameConst $iface }}
 }
 {{ range $method := $iface.Methods }}
 // {{ methodType $method }} calls {{ $iface.Name }}.{{ $method.Name }} method.
 {{- template "annotations" $method }}
 func (o *{{ ifaceType $iface }}) {{ methodType $method }}({{ joinMethodInArgs $method }}) ({{ joinMethodOutArgs $method }}err error) {
+{{- template "fileVars" $method }}
 	err = o.object.Call({{ ifaceNameConst $iface }} + "." + "{{ $method.Name }}", 0, {{ joinArgNames $method.In }}).Store({{ joinStoreArgs $method.Out }})
+{{- with keepMethodFiles $method }}
+	{{ . }}
+{{- end }}
+{{- if hasFileOuts $method }}
+	if err != nil {
+		return
+	}
+{{- template "newFiles" $method }}
+{{- end }}
+	return
+}
+{{- $h := refHelper $method }}
+{{- if $h }}
+
+// {{ $h.Name }} calls {{ $iface.Name }}.{{ $method.Name }} method
+// and returns proxies of objects it refers to, created with {{ $h.Conn }}.
+func (o *{{ ifaceType $iface }}) {{ $h.Name }}({{ $h.Conn }} Conn, {{ joinMethodInArgs $method }}) ({{ joinRefOutArgs $method }}err error) {
+{{- range $arg := $method.Out }}
+{{- if refIface $arg }}
+	var {{ index $h.Paths $arg }} {{ $arg.Type }}
+{{- end }}
+{{- end }}
+{{- template "fileVars" $method }}
+	err = o.object.Call({{ ifaceNameConst $iface }} + "." + "{{ $method.Name }}", 0, {{ joinArgNames $method.In }}).Store({{ joinRefStoreArgs $method }})
+{{- with keepMethodFiles $method }}
+	{{ . }}
+{{- end }}
+	if err != nil {
+		return
+	}
+{{- template "newFiles" $method }}
+{{- range $i, $arg := $method.Out }}
+{{- if refIface $arg }}
+{{- template "refProxy" (refProxy $h $arg (argName $arg "out" $i false)) }}
+{{- end }}
+{{- end }}
 	return
 }
+{{- end }}
 {{ end }}
+{{- if feature "properties" }}
 {{- range $prop := $iface.Properties }}
 {{- if propNeedsGet $iface $prop }}
 // {{ propGetType $prop }} gets {{ $iface.Name }}.{{ $prop.Name }} property.
@@ -201,8 +854,29 @@ func (o *{{ ifaceType $iface }}) {{ propSetType $prop }}({{ propArgName $prop }}
 	return o.object.Call(methodPropertySet, 0, {{ ifaceNameConst $iface }}, "{{ $prop.Name }}", {{ propArgName $prop }}).Store()
 }
 {{- end }}
+{{- $h := refHelper $prop }}
+{{- if $h }}
+
+// {{ $h.Name }} gets {{ $iface.Name }}.{{ $prop.Name }} property
+// and returns proxies of objects it refers to, created with {{ $h.Conn }}.
+func (o *{{ ifaceType $iface }}) {{ $h.Name }}({{ $h.Conn }} Conn) ({{ propArgName $prop }} {{ refType $prop.Arg }}, err error) {
+	var {{ index $h.Paths $prop.Arg }} {{ $prop.Arg.Type }}
+	err = o.object.Call(methodPropertyGet, 0, {{ ifaceNameConst $iface }}, "{{ $prop.Name }}").Store(&{{ index $h.Paths $prop.Arg }})
+	if err != nil {
+		return
+	}
+{{- template "refProxy" (refProxy $h $prop.Arg (propArgName $prop)) }}
+	return
+}
+{{- end }}
 {{ end }}
+{{- end }}
+{{- if standard }}
+{{- template "standard" $iface }}
+{{- end }}
+{{- end }}
 {{ range $signal := $iface.Signals }}
+{{- if feature "signals" }}
 // {{ signalType $iface $signal }} represents {{ $iface.Name }}.{{ $signal.Name }} signal.
 {{- template "annotations" $signal }}
 type {{ signalType $iface $signal }} struct {
@@ -230,37 +904,172 @@ func (s *{{ signalType $iface $signal }}) Sender() string {
 func (s *{{ signalType $iface $signal }}) Path() dbus.ObjectPath {
 	return s.path
 }
+{{- end }}
 
 // {{ signalBodyType $iface $signal }} is body container.
 type {{ signalBodyType $iface $signal }} struct {
 	{{ joinSignalArgs $signal }}
 }
 {{ end }}
+{{- if feature "server" }}
+{{- template "serverIface" $iface }}
+{{- end }}
+{{- if feature "mocks" }}
+{{ template "mockIface" $iface }}
+{{- end }}
 {{- end }}`
 
 type tmplContext struct {
+	Version     string
+	InputHash   string
 	PackageName string
+	Runtime     bool
+	Standard    bool
 	Interfaces  []*token.Interface
 }
 
+// signalContext is the context of templates rendering a signal.
+type signalContext struct {
+	Ctx    *tmplContext
+	Iface  *token.Interface
+	Signal *token.Signal
+}
+
+// storeContext is the context of the template storing
+// changed properties, Results precede err in return statements.
+type storeContext struct {
+	Iface   *token.Interface
+	Results string
+}
+
+// refContext is the context of the template converting
+// the object path variable Path into proxies stored to Name.
+type refContext struct {
+	Helper *refHelper
+	Arg    *token.Arg
+	Name   string
+	Path   string
+}
+
+// newContext creates template context for the given interfaces.
+func (p *printer) newContext(ifaces []*token.Interface) *tmplContext {
+	return &tmplContext{
+		Version:     Version,
+		InputHash:   p.inputHash,
+		PackageName: p.pkgName,
+		Runtime:     p.runtime,
+		Standard:    p.standard,
+		Interfaces:  ifaces,
+	}
+}
+
 // Print generates code for the provided interfaces and writes it to out.
 func Print(out io.Writer, ifaces []*token.Interface, opts ...PrintOption) error {
+	return execute(out, srcTemplate, ifaces, opts)
+}
+
+// PrintFiles generates code for the provided interfaces split into
+// one file per interface plus CommonFile with declarations shared by them,
+// the result is mapped by file names that depend only on interface names.
+func PrintFiles(ifaces []*token.Interface, opts ...PrintOption) (map[string][]byte, error) {
+	return executeFiles(srcTemplate, "", ifaces, opts)
+}
+
+// CommonFile is the name of file produced by PrintFiles
+// that contains declarations shared by all interfaces.
+const CommonFile = "common.go"
+
+// execute renders the given template source for the given interfaces.
+func execute(out io.Writer, src string, ifaces []*token.Interface, opts []PrintOption) error {
+	p, tmpl, err := newPrinter(src, ifaces, opts)
+	if err != nil {
+		return err
+	}
+	b, err := p.render(tmpl, "main", p.newContext(ifaces))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
+
+// executeFiles is execute that renders every interface into its own file,
+// suffix is appended to all file names before the extension.
+func executeFiles(src, suffix string, ifaces []*token.Interface, opts []PrintOption) (map[string][]byte, error) {
+	p, tmpl, err := newPrinter(src, ifaces, opts)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(ifaces)+1)
+	if files[fileName(CommonFile, suffix)], err = p.render(tmpl, "commonFile", p.newContext(ifaces)); err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		// interface names have at least two elements,
+		// so they never collide with CommonFile
+		name := strings.ToLower(strings.Replace(iface.Name, "_", "-", -1))
+		base := name
+		for i := 2; files[fileName(name+".go", suffix)] != nil; i++ {
+			name = base + "-" + strconv.Itoa(i)
+		}
+		if files[fileName(name+".go", suffix)], err = p.render(
+			tmpl, "ifaceFile", p.newContext([]*token.Interface{iface}),
+		); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// fileName inserts suffix into the go file name,
+// underscores are never used in interface file names,
+// so suffixes cannot turn them into build-constrained files.
+func fileName(name, suffix string) string {
+	if suffix == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, ".go") + "_" + suffix + ".go"
+}
+
+// newPrinter configures a printer and parses the template source with it,
+// mock and server bodies are parsed along, so any source can embed them.
+func newPrinter(src string, ifaces []*token.Interface, opts []PrintOption) (*printer, *template.Template, error) {
 	p := &printer{
-		pkgName: "dbusgen",
-		gofmt:   true,
+		pkgName:  "dbusgen",
+		gofmt:    true,
+		features: DefaultFeatures,
 	}
+	WithInitialisms(DefaultInitialisms)(p)
 	for _, opt := range opts {
 		opt(p)
 	}
 	if !identRegexp.MatchString(p.pkgName) {
-		return errors.New("package name is not valid")
+		return nil, nil, errors.New("package name is not valid")
 	}
 	if len(ifaces) == 0 {
-		return errors.New("no interfaces given")
+		return nil, nil, errors.New("no interfaces given")
 	}
 
+	if err := validateRefs(ifaces); err != nil {
+		return nil, nil, err
+	}
+	if err := p.parsePathTemplates(ifaces); err != nil {
+		return nil, nil, err
+	}
+	declared := newScope(reservedPkgIdents...)
+	declared.add("rt", "Conn")
+	if err := p.collectEnums(ifaces, declared); err != nil {
+		return nil, nil, err
+	}
+	if err := p.collectTypes(ifaces, declared); err != nil {
+		return nil, nil, err
+	}
 	p.prepareIfaces(ifaces)
-	tmpl := template.Must(template.New("main").Funcs(template.FuncMap{
+	p.declareFiles(ifaces)
+	if err := p.resolve(ifaces); err != nil {
+		return nil, nil, err
+	}
+	tmpl := template.Must(template.New("root").Funcs(template.FuncMap{
 		"ifaceNameConst":    p.ifaceNameConst,
 		"ifaceNewType":      p.ifaceNewType,
 		"ifaceType":         p.ifaceType,
@@ -279,15 +1088,91 @@ func Print(out io.Writer, ifaces []*token.Interface, opts ...PrintOption) error
 		"joinArgNames":      p.joinArgNames,
 		"joinStoreArgs":     p.joinStoreArgs,
 		"joinSignalArgs":    p.joinSignalArgs,
-	}).Parse(srcTemplate))
+		"mockType":          p.mockType,
+		"mockNewType":       p.mockNewType,
+		"mockFuncName":      p.mockFuncName,
+		"mockEmitName":      p.mockEmitName,
+		"joinArgTypes":      p.joinArgTypes,
+		"inc": func(i int) int {
+			return i + 1
+		},
+		"pair": func(ctx *tmplContext, iface *token.Interface, signal *token.Signal) *signalContext {
+			return &signalContext{Ctx: ctx, Iface: iface, Signal: signal}
+		},
+		"runtime": func() bool {
+			return p.runtime
+		},
+		"standard": func() bool {
+			return p.standard
+		},
+		"store": func(iface *token.Interface, results string) *storeContext {
+			return &storeContext{Iface: iface, Results: results}
+		},
+		"feature":           p.feature,
+		"ifaceUsesDBus":     p.ifaceUsesDBus,
+		"serverType":        p.serverType,
+		"serverExportFunc":  p.serverExportFunc,
+		"serverEmitFunc":    p.serverEmitFunc,
+		"helperNeeded":      p.helperNeeded,
+		"readableProps":     p.readableProps,
+		"propsType":         p.propsType,
+		"buses":             func() []string { return p.buses },
+		"busConst":          p.busConst,
+		"boundDest":         p.boundDest,
+		"ifacePath":         p.ifacePath,
+		"hasPaths":          p.hasPaths,
+		"pathConst":         p.pathConst,
+		"bindFunc":          p.bindFunc,
+		"pathTemplate":      p.pathTemplate,
+		"hasPathTemplates":  p.hasPathTemplates,
+		"hasEscapes":        p.hasEscapes,
+		"pathParseFunc":     p.pathParseFunc,
+		"joinPathArgs":      p.joinPathArgs,
+		"joinPathArgNames":  p.joinPathArgNames,
+		"pathExpr":          p.pathExpr,
+		"pathMismatch":      p.pathMismatch,
+		"pathValue":         p.pathValue,
+		"enums":             func() []*token.Enum { return p.enums },
+		"enumConst":         p.enumConst,
+		"enumCases":         p.enumCases,
+		"enumZero":          p.enumZero,
+		"enumFormat":        p.enumFormat,
+		"enumMask":          p.enumMask,
+		"hasFlags":          p.hasFlags,
+		"types":             func() []*token.Type { return p.types },
+		"hasFiles":          p.hasFiles,
+		"hasMethodFiles":    p.hasMethodFiles,
+		"usesFileType":      p.usesFileType,
+		"keepMethodFiles":   p.keepMethodFiles,
+		"keepSignalFiles":   p.keepSignalFiles,
+		"joinServerOutArgs": p.joinServerOutArgs,
+		"hasFileOuts":       p.hasFileOuts,
+		"isFile":            p.isFile,
+		"argType":           p.argType,
+		"fileVar":           p.fileVar,
+		"fileWrap":          p.fileWrap,
+		"fileUnwrap":        p.fileUnwrap,
+		"mockWrap":          p.mockWrap,
+		"mockUnwrap":        p.mockUnwrap,
+		"refIface":          p.refIface,
+		"refHelper":         p.refHelper,
+		"hasRefHelpers":     p.hasRefHelpers,
+		"refType":           p.refType,
+		"isRefSlice":        p.isRefSlice,
+		"joinRefOutArgs":    p.joinRefOutArgs,
+		"joinRefStoreArgs":  p.joinRefStoreArgs,
+		"refProxy": func(h *refHelper, arg *token.Arg, name string) *refContext {
+			return &refContext{Helper: h, Arg: arg, Name: name, Path: h.Paths[arg]}
+		},
+	}).Parse(src + mockBodyTemplate + serverBodyTemplate))
+	return p, tmpl, nil
+}
 
+// render executes the named template and gofmts the result.
+func (p *printer) render(tmpl *template.Template, name string, ctx *tmplContext) ([]byte, error) {
 	var buf bytes.Buffer
-	var err error
-	if err = tmpl.Execute(&buf, &tmplContext{
-		PackageName: p.pkgName,
-		Interfaces:  ifaces,
-	}); err != nil {
-		return err
+	if err := tmpl.ExecuteTemplate(&buf, name, ctx); err != nil {
+		return nil, err
 	}
 	fset := gotoken.NewFileSet()
 	file, err := goparser.ParseFile(fset, "", buf.Bytes(), goparser.ParseComments)
@@ -296,13 +1181,16 @@ func Print(out io.Writer, ifaces []*token.Interface, opts ...PrintOption) error
 		// if _, ok := err.(scanner.ErrorList); ok {
 		// 	return errors.New("unable to parse generated code")
 		// }
-		return err
+		return nil, err
 	}
-	if p.gofmt {
-		return goformat.Node(out, fset, file)
+	if !p.gofmt {
+		return buf.Bytes(), nil
 	}
-	_, err = out.Write(buf.Bytes())
-	return err
+	var out bytes.Buffer
+	if err = goformat.Node(&out, fset, file); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
 }
 
 // prepareIfaces sorts the given interfaces and all their nested entities.
@@ -324,19 +1212,31 @@ func (p *printer) prepareIfaces(ifaces []*token.Interface) {
 }
 
 func isKeyword(s string) bool {
-	// TODO: validate it doesn't match imported package names
 	return gotoken.Lookup(s).IsKeyword()
 }
 
 var ifaceRegexp = regexp.MustCompile(`[._][a-zA-Z0-9]`)
 
 func (p *printer) ifaceType(iface *token.Interface) string {
-	name := iface.Name
+	if name, ok := p.ifaceTypes[iface]; ok {
+		return name
+	}
+	return p.ifaceIdent(iface)
+}
+
+// ifaceIdent converts the interface name into a type name without resolving conflicts.
+func (p *printer) ifaceIdent(iface *token.Interface) string {
+	return p.dottedIdent(p.rename(RenameInterface, iface.Name))
+}
+
+// dottedIdent converts a dot-separated interface name
+// into an identifier stripping prefixes.
+func (p *printer) dottedIdent(name string) string {
 	for _, prefix := range p.prefixes {
 		if prefix[len(prefix)-1] == '.' {
 			prefix = prefix[:len(prefix)-1]
 		}
-		if i := strings.Index(name, prefix); i != -1 {
+		if i := strings.Index(name, prefix); i != -1 && i+len(prefix) < len(name) {
 			name = name[i+len(prefix)+1:]
 			break
 		}
@@ -345,9 +1245,17 @@ func (p *printer) ifaceType(iface *token.Interface) string {
 	if isKeyword(name) {
 		return name
 	}
-	return ifaceRegexp.ReplaceAllStringFunc(name, func(s string) string {
-		return "_" + strings.ToUpper(s[1:])
-	})
+	return p.initialize(ifaceRegexp.ReplaceAllStringFunc(name, func(s string) string {
+		return p.typeSep() + strings.ToUpper(s[1:])
+	}))
+}
+
+// typeSep separates parts of type names according to the naming style.
+func (p *printer) typeSep() string {
+	if p.style == CamelCase {
+		return ""
+	}
+	return "_"
 }
 
 func (p *printer) ifaceNewType(iface *token.Interface) string {
@@ -358,6 +1266,58 @@ func (p *printer) ifaceNameConst(iface *token.Interface) string {
 	return "Interface" + p.ifaceType(iface)
 }
 
+// busIdent converts the whole bus name into an identifier,
+// characters that cannot be used in identifiers separate its parts.
+func (p *printer) busIdent(dest string) string {
+	parts := strings.FieldsFunc(dest, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+	})
+	for i := range parts {
+		parts[i] = strings.Title(parts[i])
+	}
+	return p.initialize(strings.Join(parts, p.typeSep()))
+}
+
+func (p *printer) busConst(dest string) string {
+	return p.busConsts[dest]
+}
+
+// ifacePath is the only path the interface was found at or empty,
+// it's always empty when the interface has a path template.
+func (p *printer) ifacePath(iface *token.Interface) string {
+	if len(iface.Paths) != 1 || p.pathTemplates[iface] != nil {
+		return ""
+	}
+	return iface.Paths[0]
+}
+
+func (p *printer) hasPaths(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		if p.ifacePath(iface) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// boundDest is the only bus name of the interface found at a single path
+// or having a path template, so its objects are known and it's bound
+// to them, otherwise it's empty.
+func (p *printer) boundDest(iface *token.Interface) string {
+	if len(iface.Dests) != 1 || p.ifacePath(iface) == "" && p.pathTemplates[iface] == nil {
+		return ""
+	}
+	return iface.Dests[0]
+}
+
+func (p *printer) pathConst(iface *token.Interface) string {
+	return "Path" + p.ifaceType(iface)
+}
+
+func (p *printer) bindFunc(iface *token.Interface) string {
+	return "Bind" + p.ifaceType(iface)
+}
+
 func (p *printer) ifaceHasMethod(iface *token.Interface, name string) bool {
 	for _, method := range iface.Methods {
 		if method.Name == name {
@@ -377,11 +1337,25 @@ func (p *printer) ifacesHaveSignals(ifaces []*token.Interface) bool {
 }
 
 func (p *printer) methodType(method *token.Method) string {
-	return strings.Title(method.Name)
+	if name, ok := p.methodTypes[method]; ok {
+		return name
+	}
+	return p.methodIdent(method)
+}
+
+func (p *printer) methodIdent(method *token.Method) string {
+	return p.initialize(strings.Title(p.rename(RenameMethod, method.Name)))
 }
 
 func (p *printer) propType(prop *token.Property) string {
-	return strings.Title(prop.Name)
+	if name, ok := p.propTypes[prop]; ok {
+		return name
+	}
+	return p.propIdent(prop)
+}
+
+func (p *printer) propIdent(prop *token.Property) string {
+	return p.initialize(strings.Title(p.rename(RenameProperty, prop.Name)))
 }
 
 func (p *printer) propGetType(prop *token.Property) string {
@@ -408,25 +1382,100 @@ func (p *printer) propNeedsGet(iface *token.Interface, prop *token.Property) boo
 
 func (p *printer) propNeedsAccessor(iface *token.Interface, name string) bool {
 	for _, method := range iface.Methods {
-		if method.Name == name {
+		if p.methodType(method) == name {
+			return false
+		}
+	}
+	return true
+}
+
+// helperNeeded reports whether the standard helper method doesn't
+// clash with generated methods and property accessors of the interface.
+func (p *printer) helperNeeded(iface *token.Interface, name string) bool {
+	if !p.propNeedsAccessor(iface, name) {
+		return false
+	}
+	for _, prop := range iface.Properties {
+		if p.propGetType(prop) == name || p.propSetType(prop) == name {
 			return false
 		}
 	}
 	return true
 }
 
+func (p *printer) readableProps(iface *token.Interface) bool {
+	for _, prop := range iface.Properties {
+		if prop.Read {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) propsType(iface *token.Interface) string {
+	if name, ok := p.propsTypes[iface]; ok {
+		return name
+	}
+	return p.ifaceType(iface) + p.typeSep() + "Properties"
+}
+
 func (p *printer) signalType(iface *token.Interface, signal *token.Signal) string {
-	return p.ifaceType(iface) + "_" + strings.Title(signal.Name) + "Signal"
+	return p.ifaceType(iface) + p.typeSep() + p.signalName(signal) + "Signal"
+}
+
+// signalName is the signal part of signal type names, it's unique
+// within the interface, since the types are unique within the package.
+func (p *printer) signalName(signal *token.Signal) string {
+	if name, ok := p.signalTypes[signal]; ok {
+		return name
+	}
+	return p.signalIdent(signal)
 }
 
 func (p *printer) signalBodyType(iface *token.Interface, signal *token.Signal) string {
 	return p.signalType(iface, signal) + "Body"
 }
 
+// initialize upper-cases words of the identifier that are initialisms,
+// words are separated by underscores and lower to non-lower case transitions,
+// the leading word stays lower-cased the same way golint does it.
+func (p *printer) initialize(name string) string {
+	if len(p.initialisms) == 0 {
+		return name
+	}
+	runes := []rune(name)
+	for w, i := 0, 0; i < len(runes); i++ {
+		if runes[i] == '_' {
+			w = i + 1
+			continue
+		}
+		if i+1 != len(runes) && runes[i+1] != '_' &&
+			(!unicode.IsLower(runes[i]) || unicode.IsLower(runes[i+1])) {
+			continue
+		}
+		if u := strings.ToUpper(string(runes[w : i+1])); p.initialisms[u] {
+			if w == 0 && unicode.IsLower(runes[0]) {
+				u = strings.ToLower(u)
+			}
+			copy(runes[w:], []rune(u))
+		}
+		w = i + 1
+	}
+	return string(runes)
+}
+
 var varRegexp = regexp.MustCompile("_+[a-zA-Z0-9]")
 
 func (p *printer) argName(arg *token.Arg, prefix string, i int, export bool) string {
-	name := arg.Name
+	if name, ok := p.argNames[arg]; ok {
+		return name
+	}
+	return p.argIdent(arg, prefix, i, export)
+}
+
+// argIdent converts the argument name into a variable name without resolving conflicts.
+func (p *printer) argIdent(arg *token.Arg, prefix string, i int, export bool) string {
+	name := p.rename(RenameArg, arg.Name)
 	if name == "" {
 		name = prefix + strconv.Itoa(i)
 	} else {
@@ -438,6 +1487,7 @@ func (p *printer) argName(arg *token.Arg, prefix string, i int, export bool) str
 	if export {
 		name = strings.Title(name)
 	}
+	name = p.initialize(name)
 	if isKeyword(name) {
 		return prefix + strings.Title(name)
 	}
@@ -455,7 +1505,11 @@ func (p *printer) joinStoreArgs(args []*token.Arg) string {
 			buf.WriteByte(',')
 		}
 		buf.WriteByte('&')
-		buf.WriteString(p.argName(args[i], "out", i, false))
+		if name := p.fileVar(args[i]); name != "" {
+			buf.WriteString(name)
+		} else {
+			buf.WriteString(p.argName(args[i], "out", i, false))
+		}
 	}
 	return buf.String()
 }
@@ -465,7 +1519,7 @@ func (p *printer) joinArgs(args []*token.Arg, separator byte, suffix string, exp
 	for i := range args {
 		buf.WriteString(p.argName(args[i], suffix, i, export))
 		buf.WriteByte(' ')
-		buf.WriteString(args[i].Type)
+		buf.WriteString(p.argType(args[i]))
 		buf.WriteByte(separator)
 	}
 	return buf.String()
@@ -483,13 +1537,24 @@ func (p *printer) joinMethodOutArgs(method *token.Method) string {
 	return p.joinArgs(method.Out, ',', "out", false)
 }
 
+func (p *printer) joinArgTypes(args []*token.Arg) string {
+	var buf strings.Builder
+	for i := range args {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(p.argType(args[i]))
+	}
+	return buf.String()
+}
+
 func (p *printer) joinArgNames(args []*token.Arg) string {
 	var buf strings.Builder
 	for i := range args {
 		if i != 0 {
 			buf.WriteByte(',')
 		}
-		buf.WriteString(p.argName(args[i], "in", i, false))
+		buf.WriteString(p.fileUnwrap(args[i], p.argName(args[i], "in", i, false)))
 	}
 	return buf.String()
 }
@@ -25,6 +25,29 @@ func TestPrint(t *testing.T) {
 	// TODO: test something
 }
 
+func TestPrintFiles(t *testing.T) {
+	t.Parallel()
+
+	files, err := PrintFiles([]*token.Interface{
+		{Name: "org.Foo"},
+		{Name: "org.foo"},
+		{Name: "org.bar_test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		CommonFile, "org.foo.go", "org.foo-2.go", "org.bar-test.go",
+	} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("file %q is missing", name)
+		}
+	}
+	if len(files) != 4 {
+		t.Errorf("len(files) = %d, want 4", len(files))
+	}
+}
+
 func TestIfaceName(t *testing.T) {
 	p := &printer{}
 	for name, want := range map[string]string{
@@ -37,3 +60,461 @@ func TestIfaceName(t *testing.T) {
 		}
 	}
 }
+
+func TestInitialisms(t *testing.T) {
+	t.Parallel()
+
+	p := &printer{}
+	WithInitialisms(DefaultInitialisms)(p)
+	for name, want := range map[string]string{
+		"GetId":       "GetID",
+		"GetUuid":     "GetUUID",
+		"Get_Url":     "Get_URL",
+		"HwAddress":   "HwAddress",
+		"id":          "id",
+		"deviceId":    "deviceID",
+		"Ip4Address":  "IP4Address",
+		"Identity":    "Identity",
+		"Org_Foo_Uid": "Org_Foo_UID",
+		"DBus":        "DBus",
+	} {
+		if have := p.initialize(name); have != want {
+			t.Errorf("initialize(%q) = %q, want %q", name, have, want)
+		}
+	}
+}
+
+func TestRenameRules(t *testing.T) {
+	t.Parallel()
+
+	var rules []*RenameRule
+	for _, s := range []string{
+		`iface:^org\.freedesktop\.=`,
+		`method:^Get(.+)$=Fetch$1`,
+		`property:^(.+)$=${1}Prop`,
+		`signal:Changed$=Updated`,
+		`arg:^in_(.+)$=$1`,
+	} {
+		rule, err := ParseRenameRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	p := &printer{renames: rules}
+	iface := &token.Interface{Name: "org.freedesktop.hostname1"}
+	for have, want := range map[string]string{
+		p.ifaceIdent(iface):                                     "Hostname1",
+		p.methodIdent(&token.Method{Name: "GetUnit"}):           "FetchUnit",
+		p.propIdent(&token.Property{Name: "Hostname"}):          "HostnameProp",
+		p.signalIdent(&token.Signal{Name: "PropertiesChanged"}): "PropertiesUpdated",
+		p.argIdent(&token.Arg{Name: "in_name"}, "in", 0, false): "name",
+	} {
+		if have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+	}
+
+	for _, s := range []string{"method", "foo:.*=", "arg:(=x"} {
+		if _, err := ParseRenameRule(s); err == nil {
+			t.Errorf("ParseRenameRule(%q) expected an error", s)
+		}
+	}
+
+	for _, s := range []string{
+		`iface:Session$=`, `method:^Inhibit$=In-hibit`, `property:^Name$=1Name`,
+		`signal:^Lock$=L.ock`, `arg:^who$=w-ho`,
+	} {
+		rule, err := ParseRenameRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &printer{renames: []*RenameRule{rule}}
+		if err = p.resolve([]*token.Interface{{
+			Name:       "org.example.Session",
+			Methods:    []*token.Method{{Name: "Inhibit", In: []*token.Arg{{Name: "who", Type: "string"}}}},
+			Properties: []*token.Property{{Name: "Name", Arg: &token.Arg{Name: "Name", Type: "string"}}},
+			Signals:    []*token.Signal{{Name: "Lock"}},
+		}}); err == nil {
+			t.Errorf("resolve() with %q expected an error", s)
+		}
+	}
+}
+
+func TestNamingStyle(t *testing.T) {
+	t.Parallel()
+
+	iface := &token.Interface{
+		Name:    "org.freedesktop.systemd1.Manager",
+		Signals: []*token.Signal{{Name: "unitNew"}},
+	}
+	for style, want := range map[NamingStyle][]string{
+		UglyCase: {
+			"Org_Freedesktop_Systemd1_Manager",
+			"NewOrg_Freedesktop_Systemd1_Manager",
+			"InterfaceOrg_Freedesktop_Systemd1_Manager",
+			"Org_Freedesktop_Systemd1_Manager_UnitNewSignal",
+			"Org_Freedesktop_Systemd1_Manager_UnitNewSignalBody",
+		},
+		CamelCase: {
+			"OrgFreedesktopSystemd1Manager",
+			"NewOrgFreedesktopSystemd1Manager",
+			"InterfaceOrgFreedesktopSystemd1Manager",
+			"OrgFreedesktopSystemd1ManagerUnitNewSignal",
+			"OrgFreedesktopSystemd1ManagerUnitNewSignalBody",
+		},
+	} {
+		p := &printer{style: style}
+		p.resolve([]*token.Interface{iface})
+		have := []string{
+			p.ifaceType(iface),
+			p.ifaceNewType(iface),
+			p.ifaceNameConst(iface),
+			p.signalType(iface, iface.Signals[0]),
+			p.signalBodyType(iface, iface.Signals[0]),
+		}
+		for i := range want {
+			if have[i] != want[i] {
+				t.Errorf("%s: have %q, want %q", style, have[i], want[i])
+			}
+		}
+	}
+}
+
+func TestResolveConflicts(t *testing.T) {
+	t.Parallel()
+
+	foo := &token.Interface{
+		Name: "one.Foo",
+		Methods: []*token.Method{
+			{
+				Name: "Do",
+				In: []*token.Arg{
+					{Name: "o", Type: "string"},
+					{Name: "name", Type: "string"},
+					{Name: "Name", Type: "string"},
+				},
+				Out: []*token.Arg{
+					{Name: "err", Type: "string"},
+				},
+			},
+			{Name: "do"},
+		},
+		Signals: []*token.Signal{
+			{Name: "Changed"},
+		},
+	}
+	bar := &token.Interface{Name: "two.Foo"}
+	changed := &token.Interface{Name: "three.Foo_ChangedSignal"}
+	ids := &token.Interface{
+		Name: "four.S",
+		Signals: []*token.Signal{
+			{Name: "IdChanged"},
+			{Name: "IDChanged"},
+		},
+	}
+
+	var conflicts []Conflict
+	p := &printer{
+		prefixes: []string{"one", "two", "three", "four"},
+		features: DefaultFeatures | FeatureMocks,
+		conflictFn: func(c Conflict) {
+			conflicts = append(conflicts, c)
+		},
+	}
+	WithInitialisms(DefaultInitialisms)(p)
+	p.resolve([]*token.Interface{foo, bar, changed, ids})
+	for have, want := range map[string]string{
+		p.ifaceType(foo):                            "Foo",
+		p.ifaceType(bar):                            "Foo2",
+		p.ifaceType(changed):                        "Foo_ChangedSignal",
+		p.signalType(foo, foo.Signals[0]):           "Foo_Changed2Signal",
+		p.methodType(foo.Methods[0]):                "Do",
+		p.methodType(foo.Methods[1]):                "Do2",
+		p.joinMethodInArgs(foo.Methods[0]):          "o2 string,name string,name2 string,",
+		p.joinMethodOutArgs(foo.Methods[0]):         "err2 string,",
+		p.joinStoreArgs(foo.Methods[0].Out):         "&err2",
+		p.signalBodyType(foo, foo.Signals[0]):       "Foo_Changed2SignalBody",
+		p.ifaceNewType(bar) + p.ifaceNameConst(bar): "NewFoo2InterfaceFoo2",
+		p.signalType(ids, ids.Signals[1]):           "S_IDChanged2Signal",
+		p.mockEmitName(ids.Signals[0]):              "EmitIDChanged",
+		p.mockEmitName(ids.Signals[1]):              "EmitIDChanged2",
+	} {
+		if have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+	}
+	if len(conflicts) != 7 {
+		t.Errorf("len(conflicts) = %d, want 7: %v", len(conflicts), conflicts)
+	}
+}
+
+func TestStandardHelpers(t *testing.T) {
+	t.Parallel()
+
+	foo := &token.Interface{
+		Name:    "org.Foo",
+		Methods: []*token.Method{{Name: "Ping"}},
+		Properties: []*token.Property{
+			{Name: "Properties", Arg: &token.Arg{Type: "string"}, Read: true},
+		},
+	}
+	props := &token.Interface{Name: "org.Foo.Properties"}
+	p := &printer{standard: true}
+	p.resolve([]*token.Interface{foo, props})
+	for name, want := range map[string]bool{
+		"Ping":             false,
+		"Introspect":       true,
+		"GetProperties":    false,
+		"UpdateProperties": true,
+	} {
+		if have := p.helperNeeded(foo, name); have != want {
+			t.Errorf("helperNeeded(%q) = %t, want %t", name, have, want)
+		}
+	}
+	if have := p.ifaceType(props); have != "Org_Foo_Properties" {
+		t.Errorf("ifaceType(%q) = %q, want Org_Foo_Properties", props.Name, have)
+	}
+	if have := p.propsType(foo); have != "Org_Foo_Properties2" {
+		t.Errorf("propsType(%q) = %q, want Org_Foo_Properties2", foo.Name, have)
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	t.Parallel()
+
+	f, err := ParseFeatures([]string{"server", "client", "mocks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != FeatureClient|FeatureServer|FeatureMocks {
+		t.Errorf("ParseFeatures() = %s, want client,server,mocks", f)
+	}
+	if s := DefaultFeatures.String(); s != "types,client,signals,properties" {
+		t.Errorf("DefaultFeatures.String() = %q", s)
+	}
+	if _, err = ParseFeatures([]string{"types-only"}); err == nil {
+		t.Error("ParseFeatures(types-only) succeeded")
+	}
+	if _, err = ParseFeatures([]string{"signals", "properties"}); err == nil {
+		t.Error("ParseFeatures(signals,properties) succeeded")
+	}
+}
+
+func TestRefHelpers(t *testing.T) {
+	t.Parallel()
+
+	unit := &token.Interface{Name: "org.Unit"}
+	getUnit := &token.Method{
+		Name: "GetUnit",
+		In:   []*token.Arg{{Name: "conn", Type: "string"}},
+		Out:  []*token.Arg{{Name: "unit", Type: "dbus.ObjectPath", Ref: "org.Unit"}},
+	}
+	listUnits := &token.Method{
+		Name: "ListUnits",
+		Out:  []*token.Arg{{Name: "units", Type: "[]dbus.ObjectPath", Ref: "org.Unit"}},
+	}
+	manager := &token.Interface{
+		Name: "org.Manager",
+		Methods: []*token.Method{
+			getUnit, listUnits, {Name: "ListUnitsProxy"},
+			{Name: "GetOther", Out: []*token.Arg{{Type: "dbus.ObjectPath", Ref: "org.Other"}}},
+		},
+	}
+	p := &printer{}
+	p.resolve([]*token.Interface{manager, unit})
+	h := p.refHelper(getUnit)
+	if h == nil {
+		t.Fatal("GetUnit has no helper")
+	}
+	if h.Name != "GetUnitProxy" || h.Conn != "conn2" || h.Paths[getUnit.Out[0]] != "unitPath" {
+		t.Errorf("GetUnit helper = %+v", h)
+	}
+	if h = p.refHelper(listUnits); h != nil {
+		t.Errorf("ListUnits helper = %+v, want nil, it clashes with a method", h)
+	}
+	if h = p.refHelper(manager.Methods[3]); h != nil {
+		t.Errorf("GetOther helper = %+v, want nil, org.Other isn't generated", h)
+	}
+
+	bad := &token.Interface{
+		Name:       "org.Bad",
+		Properties: []*token.Property{{Name: "Unit", Arg: &token.Arg{Type: "string", Ref: "org.Unit"}}},
+	}
+	if err := validateRefs([]*token.Interface{bad}); err == nil {
+		t.Error("validateRefs() succeeded with a string property")
+	}
+}
+
+func TestBoundConstructors(t *testing.T) {
+	t.Parallel()
+
+	manager := &token.Interface{
+		Name:  "org.example.Manager",
+		Dests: []string{"org.example"},
+		Paths: []string{"/org/example"},
+	}
+	unit := &token.Interface{
+		Name:  "org.example.Unit",
+		Dests: []string{"org.example"},
+		Paths: []string{"/org/example/a", "/org/example/b"},
+	}
+	taken := &token.Interface{Name: "BusNameOrg.Example"}
+	p := &printer{}
+	p.resolve([]*token.Interface{manager, unit, taken})
+	if have := p.busConst("org.example"); have != "BusNameOrg_Example2" {
+		t.Errorf("busConst(org.example) = %q, want BusNameOrg_Example2", have)
+	}
+	if p.boundDest(manager) != "org.example" || p.boundDest(unit) != "" {
+		t.Errorf("boundDest() = %q, %q, want org.example and nothing", p.boundDest(manager), p.boundDest(unit))
+	}
+	if p.ifacePath(unit) != "" {
+		t.Errorf("ifacePath(%q) = %q, want nothing", unit.Name, p.ifacePath(unit))
+	}
+
+	// prefixes don't apply to bus names, so a name equal to one is fine
+	systemd := &token.Interface{
+		Name:  "org.freedesktop.systemd1.Manager",
+		Dests: []string{"org.freedesktop.systemd1", "com.example.my-app", "com._.x"},
+	}
+	p = &printer{prefixes: []string{"org.freedesktop.systemd1"}}
+	if err := p.resolve([]*token.Interface{systemd}); err != nil {
+		t.Fatal(err)
+	}
+	for dest, want := range map[string]string{
+		"org.freedesktop.systemd1": "BusNameOrg_Freedesktop_Systemd1",
+		"com.example.my-app":       "BusNameCom_Example_My_App",
+		"com._.x":                  "BusNameCom_X",
+	} {
+		if have := p.busConst(dest); have != want {
+			t.Errorf("busConst(%s) = %q, want %q", dest, have, want)
+		}
+	}
+	if have := p.ifaceType(systemd); have != "Manager" {
+		t.Errorf("ifaceType(%s) = %q, want Manager", systemd.Name, have)
+	}
+	if err := Print(&bytes.Buffer{}, []*token.Interface{systemd}, WithPrefixes([]string{"org.freedesktop.systemd1"})); err != nil {
+		t.Errorf("Print() error = %v", err)
+	}
+
+	p = &printer{}
+	bad := &token.Interface{Name: "org.Bad", Dests: []string{"-._"}}
+	if err := p.resolve([]*token.Interface{bad}); err == nil {
+		t.Errorf("resolve() succeeded with bus name %q", bad.Dests[0])
+	}
+}
+
+func TestPathTemplates(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{
+		"org/example/{name}", "/", "/org/example", "/org//{name}", "/org/{name", "/org/{name:upper}",
+		"/org/{1name}", "/org/{name}/{name}", "/org/ex-ample/{name}",
+	} {
+		if _, err := parsePathTemplate(s); err == nil {
+			t.Errorf("parsePathTemplate(%q) succeeded", s)
+		}
+	}
+
+	unit := &token.Interface{
+		Name:         "org.example.Unit",
+		Dests:        []string{"org.example"},
+		PathTemplate: "/org/example/{host}/unit_{name:escape}",
+	}
+	p := &printer{}
+	if err := p.parsePathTemplates([]*token.Interface{unit}); err != nil {
+		t.Fatal(err)
+	}
+	p.resolve([]*token.Interface{unit})
+	tmpl := p.pathTemplate(unit)
+	if have, want := p.pathExpr(tmpl),
+		`dbus.ObjectPath("/org/example/" + host + "/unit_" + escapePathLabel(name))`; have != want {
+		t.Errorf("pathExpr() = %s, want %s", have, want)
+	}
+	if have, want := p.pathValue(tmpl, tmpl.Elems[3]), "elems[4][5:]"; have != want {
+		t.Errorf("pathValue() = %s, want %s", have, want)
+	}
+	if p.boundDest(unit) != "org.example" || p.ifacePath(unit) != "" {
+		t.Errorf("unit is not bound by its path template")
+	}
+}
+
+func TestEnums(t *testing.T) {
+	t.Parallel()
+
+	state := &token.Enum{Name: "State", Values: []*token.EnumValue{
+		{Name: "Off", Value: 0}, {Name: "On", Value: 1}, {Name: "Default", Value: 0},
+	}}
+	caps := &token.Enum{Name: "Caps", Type: "byte", Flags: true, Values: []*token.EnumValue{
+		{Name: "None", Value: 0}, {Name: "Read", Value: 1}, {Name: "Write", Value: 2},
+	}}
+	iface := &token.Interface{Name: "State", Enums: []*token.Enum{state}}
+	p := &printer{enums: []*token.Enum{caps}}
+	if err := p.collectEnums([]*token.Interface{iface}, newScope()); err != nil {
+		t.Fatal(err)
+	}
+	if p.enums[0] != caps || p.enums[1] != state || state.Type != "uint32" {
+		t.Errorf("enums aren't sorted or typed")
+	}
+	if have := len(p.enumCases(state)); have != 2 {
+		t.Errorf("len(enumCases(State)) = %d, want 2", have)
+	}
+	if have, want := p.enumMask(caps), "CapsRead | CapsWrite"; have != want {
+		t.Errorf("enumMask(Caps) = %q, want %q", have, want)
+	}
+
+	// generated names step aside, the interface type is State
+	p.resolve([]*token.Interface{iface})
+	if have := p.ifaceType(iface); have != "State2" {
+		t.Errorf("ifaceType() = %q, want State2", have)
+	}
+
+	for _, enums := range [][]*token.Enum{
+		{{Name: "state"}},
+		{{Name: "Interface"}},
+		{{Name: "State", Type: "string"}},
+		{{Name: "State", Type: "byte", Values: []*token.EnumValue{{Name: "Max", Value: 256}}}},
+		{{Name: "StateOn"}, {Name: "State", Values: []*token.EnumValue{{Name: "On", Value: 1}}}},
+		{{Name: "State", Flags: true}, {Name: "State"}},
+	} {
+		p := &printer{enums: enums}
+		if err := p.collectEnums(nil, newScope(reservedPkgIdents...)); err == nil {
+			t.Errorf("collectEnums(%+v) succeeded", enums)
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	t.Parallel()
+
+	info := &token.Type{Name: "Info", Sig: "(ou)", Fields: []*token.Arg{
+		{Name: "Path", Type: "dbus.ObjectPath"}, {Name: "Handle", Type: "uint32"},
+	}}
+	handles := &token.Type{Name: "Handles", Sig: "a{us}", Type: "map[uint32]string"}
+	iface := &token.Interface{Name: "Info", Types: []*token.Type{info, handles}}
+	p := &printer{types: []*token.Type{{Name: "Info", Sig: "(ou)", Fields: []*token.Arg{
+		{Name: "Path", Type: "dbus.ObjectPath"}, {Name: "Handle", Type: "uint32"},
+	}}}}
+	if err := p.collectTypes([]*token.Interface{iface}, newScope()); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.types) != 2 || p.types[0].Name != "Handles" || p.types[1].Name != "Info" {
+		t.Errorf("types aren't merged or sorted")
+	}
+	p.resolve([]*token.Interface{iface})
+	if have := p.ifaceType(iface); have != "Info2" {
+		t.Errorf("ifaceType() = %q, want Info2", have)
+	}
+
+	for _, types := range [][]*token.Type{
+		{{Name: "info"}},
+		{{Name: "Signal"}},
+		{{Name: "Info", Sig: "(s)"}, {Name: "Info", Sig: "(u)"}},
+		{{Name: "Info", Fields: []*token.Arg{{Name: "A", Type: "string"}, {Name: "A", Type: "string"}}}},
+	} {
+		p := &printer{types: types}
+		if err := p.collectTypes(nil, newScope(reservedPkgIdents...)); err == nil {
+			t.Errorf("collectTypes(%+v) succeeded", types)
+		}
+	}
+}
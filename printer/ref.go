@@ -0,0 +1,173 @@
+package printer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// refHelper is a proxy method returning proxies of objects
+// that out arguments of a method or a property refer to.
+type refHelper struct {
+	Name  string                // method name
+	Conn  string                // name of the Conn argument
+	Index string                // name of the index variable iterating over ao
+	Paths map[*token.Arg]string // names of variables keeping object paths
+}
+
+// validateRefs checks that only o and ao arguments refer to interfaces.
+func validateRefs(ifaces []*token.Interface) error {
+	check := func(where string, arg *token.Arg) error {
+		if arg.Ref != "" && arg.Type != "dbus.ObjectPath" && arg.Type != "[]dbus.ObjectPath" {
+			return fmt.Errorf("%s refers to %s, but its type is %s, not o or ao", where, arg.Ref, arg.Type)
+		}
+		return nil
+	}
+	for _, iface := range ifaces {
+		for _, method := range iface.Methods {
+			for i, arg := range append(append([]*token.Arg{}, method.In...), method.Out...) {
+				if err := check(fmt.Sprintf("%s.%s argument %d", iface.Name, method.Name, i), arg); err != nil {
+					return err
+				}
+			}
+		}
+		for _, prop := range iface.Properties {
+			if err := check(iface.Name+"."+prop.Name, prop.Arg); err != nil {
+				return err
+			}
+		}
+		for _, signal := range iface.Signals {
+			for i, arg := range signal.Args {
+				if err := check(fmt.Sprintf("%s.%s argument %d", iface.Name, signal.Name, i), arg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// refIface returns the generated interface the argument refers to,
+// or nil when it refers to nothing or the interface isn't generated.
+func (p *printer) refIface(arg *token.Arg) *token.Interface {
+	if arg.Ref == "" {
+		return nil
+	}
+	return p.ifaceNames[arg.Ref]
+}
+
+// hasRefs reports whether any argument refers to a generated interface.
+func (p *printer) hasRefs(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		for _, method := range iface.Methods {
+			for _, arg := range method.Out {
+				if p.refIface(arg) != nil {
+					return true
+				}
+			}
+		}
+		for _, prop := range iface.Properties {
+			if p.refIface(prop.Arg) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refHelper returns the helper of the method or property or nil.
+func (p *printer) refHelper(v interface{}) *refHelper {
+	return p.refHelpers[v]
+}
+
+// hasRefHelpers reports whether any of the interfaces has helpers returning proxies.
+func (p *printer) hasRefHelpers(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		for _, method := range iface.Methods {
+			if p.refHelpers[method] != nil {
+				return true
+			}
+		}
+		for _, prop := range iface.Properties {
+			if p.refHelpers[prop] != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refType is the Go type of proxies the argument refers to.
+func (p *printer) refType(arg *token.Arg) string {
+	typ := "*" + p.ifaceType(p.refIface(arg))
+	if strings.HasPrefix(arg.Type, "[]") {
+		return "[]" + typ
+	}
+	return typ
+}
+
+func (p *printer) isRefSlice(arg *token.Arg) bool {
+	return strings.HasPrefix(arg.Type, "[]")
+}
+
+// joinRefOutArgs is joinMethodOutArgs with proxy types of referring arguments.
+func (p *printer) joinRefOutArgs(method *token.Method) string {
+	var buf strings.Builder
+	for i, arg := range method.Out {
+		buf.WriteString(p.argName(arg, "out", i, false))
+		buf.WriteByte(' ')
+		if p.refIface(arg) != nil {
+			buf.WriteString(p.refType(arg))
+		} else {
+			buf.WriteString(p.argType(arg))
+		}
+		buf.WriteByte(',')
+	}
+	return buf.String()
+}
+
+// joinRefStoreArgs is joinStoreArgs storing referring arguments to path variables.
+func (p *printer) joinRefStoreArgs(method *token.Method) string {
+	h := p.refHelpers[method]
+	var buf strings.Builder
+	for i, arg := range method.Out {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('&')
+		if name, ok := h.Paths[arg]; ok {
+			buf.WriteString(name)
+		} else if name = p.fileVar(arg); name != "" {
+			buf.WriteString(name)
+		} else {
+			buf.WriteString(p.argName(arg, "out", i, false))
+		}
+	}
+	return buf.String()
+}
+
+// declareRefHelper declares the helper and its identifiers when any of args
+// refers to a generated interface, taken contains method names of the proxy
+// and locals identifiers of the helper's body.
+func (p *printer) declareRefHelper(v interface{}, name, where string, args []*token.Arg, taken, locals scope) {
+	var refs []*token.Arg
+	for _, arg := range args {
+		if p.refIface(arg) != nil {
+			refs = append(refs, arg)
+		}
+	}
+	if len(refs) == 0 || taken.has(name) {
+		return
+	}
+	taken.add(name)
+	h := &refHelper{Name: name, Paths: make(map[*token.Arg]string, len(refs))}
+	h.Conn = p.declare(locals, where, "conn", single)
+	for _, arg := range refs {
+		h.Paths[arg] = p.declare(locals, where, p.argNames[arg]+"Path", single)
+		if p.isRefSlice(arg) && h.Index == "" {
+			h.Index = p.declare(locals, where, "i", single)
+		}
+	}
+	p.refHelpers[v] = h
+}
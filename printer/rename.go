@@ -0,0 +1,93 @@
+package printer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RenameScope is a kind of D-Bus names a rename rule applies to.
+type RenameScope string
+
+// Rename scopes.
+const (
+	RenameInterface RenameScope = "iface"
+	RenameMethod    RenameScope = "method"
+	RenameProperty  RenameScope = "property"
+	RenameSignal    RenameScope = "signal"
+	RenameArg       RenameScope = "arg"
+)
+
+// RenameRule replaces D-Bus names matching the pattern
+// before they're turned into Go identifiers.
+type RenameRule struct {
+	Scope   RenameScope
+	Pattern *regexp.Regexp
+	Replace string // template for regexp.Expand, like $1 or ${name}
+}
+
+// String returns the rule in the ParseRenameRule format.
+func (r *RenameRule) String() string {
+	return string(r.Scope) + ":" + r.Pattern.String() + "=" + r.Replace
+}
+
+// ParseRenameRule parses rules in SCOPE:PATTERN=REPLACE format,
+// for instance `method:^Get(.+)$=Fetch$1`.
+func ParseRenameRule(s string) (*RenameRule, error) {
+	i := strings.IndexByte(s, ':')
+	j := strings.LastIndexByte(s, '=')
+	if i == -1 || j < i {
+		return nil, fmt.Errorf("rename rule %q is not in SCOPE:PATTERN=REPLACE format", s)
+	}
+	scope := RenameScope(s[:i])
+	switch scope {
+	case RenameInterface, RenameMethod, RenameProperty, RenameSignal, RenameArg:
+	default:
+		return nil, fmt.Errorf("rename rule %q has unknown scope %q", s, scope)
+	}
+	pattern, err := regexp.Compile(s[i+1 : j])
+	if err != nil {
+		return nil, err
+	}
+	return &RenameRule{Scope: scope, Pattern: pattern, Replace: s[j+1:]}, nil
+}
+
+// WithRenameRules applies the given rules in order to names of their scopes,
+// interface rules are applied before stripping prefixes.
+func WithRenameRules(rules []*RenameRule) PrintOption {
+	return func(p *printer) {
+		p.renames = rules
+	}
+}
+
+// rename applies all the rules of the scope to the name.
+func (p *printer) rename(scope RenameScope, name string) string {
+	for _, rule := range p.renames {
+		if rule.Scope == scope {
+			name = rule.Pattern.ReplaceAllString(name, rule.Replace)
+		}
+	}
+	return name
+}
+
+// checkRename returns an error when rules of the scope
+// turn the name into the invalid identifier ident.
+func (p *printer) checkRename(scope RenameScope, name, ident string) error {
+	if identRegexp.MatchString(ident) {
+		return nil
+	}
+	renamed := name
+	var last *RenameRule
+	for _, rule := range p.renames {
+		if rule.Scope != scope {
+			continue
+		}
+		if s := rule.Pattern.ReplaceAllString(renamed, rule.Replace); s != renamed {
+			renamed, last = s, rule
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return fmt.Errorf("rename rule %q turns %s %s into invalid identifier %q", last, scope, name, ident)
+}
@@ -0,0 +1,283 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// Conflict is a generated identifier that clashes with another one,
+// the resolver renames it deterministically before printing.
+type Conflict struct {
+	Scope    string // where the identifier is declared: package or a D-Bus member
+	Name     string // identifier that causes the conflict
+	Resolved string // identifier used instead
+}
+
+// String implements fmt.Stringer.
+func (c Conflict) String() string {
+	return c.Scope + ": " + c.Name + " conflicts, renamed to " + c.Resolved
+}
+
+// WithConflictReport sets fn that is called for every conflicting identifier
+// the printer renames, conflicts are silently resolved by default.
+func WithConflictReport(fn func(c Conflict)) PrintOption {
+	return func(p *printer) {
+		p.conflictFn = fn
+	}
+}
+
+// reservedPkgIdents are package-level identifiers declared by templates
+// and names of imported packages that generated identifiers may shadow.
+var reservedPkgIdents = []string{
+	"Interface", "LookupInterface", "Signal", "LookupSignal", "AddMatchRule",
+	"methodPropertyGet", "methodPropertySet", "methodPropertyGetAll",
+	"methodPeerPing", "methodIntrospect", "serverError",
+	"escapePathLabel", "unescapePathLabel", "fileFD", "keepFiles", "newFile", "mockDup", "mockDupFile",
+	"MockCall", "mockObject", "mockError",
+	"context", "dbus", "log", "os", "runtime", "strconv", "strings", "sync", "syscall",
+}
+
+// reservedArgIdents are names used in function bodies beside arguments:
+// receivers, named error results and imported packages.
+var reservedArgIdents = []string{
+	"o", "err", "context", "dbus", "log", "strings", "sync", "fileFD", "keepFiles", "newFile",
+}
+
+// scope is a set of declared identifiers.
+type scope map[string]struct{}
+
+func newScope(reserved ...string) scope {
+	s := make(scope, len(reserved))
+	for _, name := range reserved {
+		s[name] = struct{}{}
+	}
+	return s
+}
+
+func (s scope) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := s[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s scope) add(names ...string) {
+	for _, name := range names {
+		s[name] = struct{}{}
+	}
+}
+
+// declare finds a free name in the scope, appending a numeric suffix to
+// the base name when needed, fn returns all identifiers the name declares,
+// the first of them is the one that's reported.
+func (p *printer) declare(s scope, where, base string, fn func(name string) []string) string {
+	name := base
+	for i := 2; s.has(fn(name)...); i++ {
+		name = base + strconv.Itoa(i)
+	}
+	s.add(fn(name)...)
+	if name != base && p.conflictFn != nil {
+		p.conflictFn(Conflict{Scope: where, Name: fn(base)[0], Resolved: fn(name)[0]})
+	}
+	return name
+}
+
+func single(name string) []string {
+	return []string{name}
+}
+
+// resolve assigns unique identifiers to all the entities of ifaces.
+func (p *printer) resolve(ifaces []*token.Interface) error {
+	p.ifaceTypes = make(map[*token.Interface]string, len(ifaces))
+	p.methodTypes = map[*token.Method]string{}
+	p.propTypes = map[*token.Property]string{}
+	p.signalTypes = map[*token.Signal]string{}
+	p.propsTypes = map[*token.Interface]string{}
+	p.argNames = map[*token.Arg]string{}
+	p.fileVars = map[*token.Arg]string{}
+	p.refHelpers = map[interface{}]*refHelper{}
+	p.ifaceNames = make(map[string]*token.Interface, len(ifaces))
+	p.busConsts = map[string]string{}
+	p.buses = nil
+	for _, iface := range ifaces {
+		p.ifaceNames[iface.Name] = iface
+	}
+
+	pkg := newScope(reservedPkgIdents...)
+	if p.runtime {
+		pkg.add("rt")
+	}
+	if p.hasRefs(ifaces) {
+		pkg.add("Conn")
+	}
+	for _, enum := range p.enums {
+		pkg.add(enum.Name)
+		pkg.add(p.enumConsts(enum)...)
+	}
+	for _, t := range p.types {
+		pkg.add(t.Name)
+	}
+	for _, iface := range ifaces {
+		if err := p.checkRename(RenameInterface, iface.Name, p.ifaceIdent(iface)); err != nil {
+			return err
+		}
+		p.ifaceTypes[iface] = p.declare(pkg, "package", p.ifaceIdent(iface), func(name string) []string {
+			names := []string{
+				name, "New" + name, "Interface" + name, "Mock" + name, "NewMock" + name,
+			}
+			if p.ifacePath(iface) != "" {
+				names = append(names, "Path"+name)
+			}
+			if p.pathTemplates[iface] != nil {
+				names = append(names, "Path"+name, "ParsePath"+name)
+			}
+			if p.boundDest(iface) != "" {
+				names = append(names, "Bind"+name)
+			}
+			if p.features&FeatureServer != 0 {
+				names = append(names, name+p.typeSep()+"Server", "Export"+name)
+			}
+			return names
+		})
+	}
+
+	// signals, bus names and property structs are resolved after all interfaces
+	// so they never take interface names
+	for _, iface := range ifaces {
+		for _, signal := range iface.Signals {
+			if err := p.checkRename(RenameSignal, signal.Name, p.signalIdent(signal)); err != nil {
+				return err
+			}
+			prefix := p.ifaceType(iface) + p.typeSep()
+			p.signalTypes[signal] = p.declare(pkg, "package", p.signalIdent(signal), func(name string) []string {
+				names := []string{
+					prefix + name + "Signal", prefix + name + "SignalBody",
+				}
+				if p.features&FeatureServer != 0 {
+					names = append(names, "Emit"+prefix+name+"Signal")
+				}
+				return names
+			})
+		}
+	}
+
+	for _, iface := range ifaces {
+		for _, dest := range iface.Dests {
+			if _, ok := p.busConsts[dest]; ok {
+				continue
+			}
+			name := p.busIdent(dest)
+			if name == "" || !identRegexp.MatchString("BusName"+name) {
+				return fmt.Errorf("bus name %q cannot be turned into an identifier", dest)
+			}
+			p.busConsts[dest] = p.declare(pkg, "package", "BusName"+name, single)
+			p.buses = append(p.buses, dest)
+		}
+	}
+
+	if p.standard {
+		for _, iface := range ifaces {
+			if !p.readableProps(iface) {
+				continue
+			}
+			p.propsTypes[iface] = p.declare(pkg, "package", p.ifaceType(iface)+p.typeSep()+"Properties", single)
+		}
+	}
+
+	for _, iface := range ifaces {
+		where := iface.Name
+		typ := newScope()
+		if p.runtime {
+			typ.add("Interface")
+		}
+		for _, method := range iface.Methods {
+			if err := p.checkRename(RenameMethod, method.Name, p.methodIdent(method)); err != nil {
+				return err
+			}
+			p.methodTypes[method] = p.declare(typ, where, p.methodIdent(method), single)
+		}
+		p.declarePathTemplate(iface)
+		props := newScope()
+		for _, prop := range iface.Properties {
+			if err := p.checkRename(RenameProperty, prop.Name, p.propIdent(prop)); err != nil {
+				return err
+			}
+			p.propTypes[prop] = p.declare(props, where, p.propIdent(prop), single)
+		}
+
+		// helpers returning proxies skip names of methods and accessors
+		helpers := newScope()
+		for _, method := range iface.Methods {
+			helpers.add(p.methodType(method))
+		}
+		for _, prop := range iface.Properties {
+			helpers.add(p.propGetType(prop), p.propSetType(prop))
+		}
+
+		for _, method := range iface.Methods {
+			where := iface.Name + "." + method.Name
+			args := newScope(reservedArgIdents...)
+			for i, arg := range method.In {
+				p.argNames[arg] = p.declare(args, where, p.argIdent(arg, "in", i, false), single)
+			}
+			for i, arg := range method.Out {
+				p.argNames[arg] = p.declare(args, where, p.argIdent(arg, "out", i, false), single)
+			}
+			for _, arg := range method.Out {
+				if p.fileArgs[arg] {
+					p.fileVars[arg] = p.declare(args, where, p.argNames[arg]+"FD", single)
+				}
+			}
+			p.declareRefHelper(method, p.methodType(method)+"Proxy", where, method.Out, helpers, args)
+		}
+		for _, prop := range iface.Properties {
+			where := iface.Name + "." + prop.Name
+			args := newScope(reservedArgIdents...)
+			p.argNames[prop.Arg] = p.declare(args, where, p.argIdent(prop.Arg, "v", 0, false), single)
+			if prop.Read {
+				p.declareRefHelper(prop, p.propGetType(prop)+"Proxy", where, []*token.Arg{prop.Arg}, helpers, args)
+			}
+		}
+		for _, signal := range iface.Signals {
+			where := iface.Name + "." + signal.Name
+			fields := newScope()
+			for i, arg := range signal.Args {
+				p.argNames[arg] = p.declare(fields, where, p.argIdent(arg, "v", i, true), single)
+			}
+		}
+		if err := p.checkArgRenames(iface); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkArgRenames checks identifiers of renamed arguments of the interface.
+func (p *printer) checkArgRenames(iface *token.Interface) error {
+	var args []*token.Arg
+	for _, method := range iface.Methods {
+		args = append(append(args, method.In...), method.Out...)
+	}
+	for _, prop := range iface.Properties {
+		args = append(args, prop.Arg)
+	}
+	for _, signal := range iface.Signals {
+		args = append(args, signal.Args...)
+	}
+	for _, arg := range args {
+		if err := p.checkRename(RenameArg, arg.Name, p.argNames[arg]); err != nil {
+			return fmt.Errorf("%s: %s", iface.Name, err)
+		}
+	}
+	return nil
+}
+
+// signalIdent is the signal part of the signal type name.
+func (p *printer) signalIdent(signal *token.Signal) string {
+	return p.initialize(strings.Title(p.rename(RenameSignal, signal.Name)))
+}
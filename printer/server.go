@@ -0,0 +1,95 @@
+package printer
+
+import (
+	"strings"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// serverBodyTemplate declares server stubs, it's embedded
+// into srcTemplate with FeatureServer.
+const serverBodyTemplate = `
+{{- define "serverCommon" }}
+
+// serverError converts errors returned by servers into D-Bus errors,
+// ones that aren't *dbus.Error are sent as org.freedesktop.DBus.Error.Failed.
+func serverError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*dbus.Error); ok {
+		return e
+	}
+	return dbus.MakeFailedError(err)
+}
+{{- end }}
+
+{{- define "serverIface" }}
+{{- $iface := . }}
+{{- if $iface.Methods }}
+// {{ serverType $iface }} is implemented by servers of {{ $iface.Name }} D-Bus interface.
+type {{ serverType $iface }} interface {
+{{- range $method := $iface.Methods }}
+	// {{ methodType $method }} handles {{ $iface.Name }}.{{ $method.Name }} method.
+	{{ methodType $method }}({{ joinMethodInArgs $method }}) ({{ joinServerOutArgs $method }}err error)
+{{- end }}
+}
+
+// {{ serverExportFunc $iface }} exports srv as {{ $iface.Name }} at the path on conn,
+// errors it returns that aren't *dbus.Error are sent as org.freedesktop.DBus.Error.Failed.
+func {{ serverExportFunc $iface }}(conn *dbus.Conn, path dbus.ObjectPath, srv {{ serverType $iface }}) error {
+	return conn.ExportMethodTable(map[string]interface{}{
+{{- range $method := $iface.Methods }}
+		"{{ $method.Name }}": func(
+{{- range $i, $arg := $method.In }}{{ if $i }}, {{ end }}in{{ $i }} {{ $arg.Type }}{{ end -}}
+		) ({{ range $i, $arg := $method.Out }}{{ $arg.Type }}, {{ end }}*dbus.Error) {
+			{{ range $i, $arg := $method.Out }}out{{ $i }}, {{ end }}err := srv.{{ methodType $method }}(
+{{- range $i, $arg := $method.In }}{{ if $i }}, {{ end }}{{ fileWrap $arg (printf "in%d" $i) }}{{ end -}}
+			)
+			return {{ range $i, $arg := $method.Out }}out{{ $i }}, {{ end }}serverError(err)
+		},
+{{- end }}
+	}, path, {{ ifaceNameConst $iface }})
+}
+{{ end }}
+{{- range $signal := $iface.Signals }}
+// {{ serverEmitFunc $iface $signal }} emits {{ $iface.Name }}.{{ $signal.Name }} signal from the path on conn.
+func {{ serverEmitFunc $iface $signal }}(conn *dbus.Conn, path dbus.ObjectPath, body *{{ signalBodyType $iface $signal }}) error {
+{{- with keepSignalFiles $signal }}
+	err := conn.Emit(path, {{ ifaceNameConst $iface }} + "." + "{{ $signal.Name }}"
+{{- range $i, $arg := $signal.Args }}, {{ fileUnwrap $arg (printf "body.%s" (argName $arg "v" $i true)) }}{{ end }})
+	{{ . }}
+	return err
+{{- else }}
+	return conn.Emit(path, {{ ifaceNameConst $iface }} + "." + "{{ $signal.Name }}"
+{{- range $i, $arg := $signal.Args }}, {{ fileUnwrap $arg (printf "body.%s" (argName $arg "v" $i true)) }}{{ end }})
+{{- end }}
+}
+{{ end }}
+{{- end }}`
+
+// joinServerOutArgs is joinMethodOutArgs keeping dbus.UnixFD,
+// servers never learn when replies are sent, so they keep
+// owning descriptors they return and decide when to close them.
+func (p *printer) joinServerOutArgs(method *token.Method) string {
+	var buf strings.Builder
+	for i, arg := range method.Out {
+		buf.WriteString(p.argName(arg, "out", i, false))
+		buf.WriteByte(' ')
+		buf.WriteString(arg.Type)
+		buf.WriteByte(',')
+	}
+	return buf.String()
+}
+
+func (p *printer) serverType(iface *token.Interface) string {
+	return p.ifaceType(iface) + p.typeSep() + "Server"
+}
+
+func (p *printer) serverExportFunc(iface *token.Interface) string {
+	return "Export" + p.ifaceType(iface)
+}
+
+func (p *printer) serverEmitFunc(iface *token.Interface, signal *token.Signal) string {
+	return "Emit" + p.signalType(iface, signal)
+}
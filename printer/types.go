@@ -0,0 +1,78 @@
+package printer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tq-systems/go-dbus-codegen/token"
+)
+
+// WithTypes adds named struct and dictionary types that aren't
+// declared by interfaces, types of the same name must be equal.
+func WithTypes(types []*token.Type) PrintOption {
+	return func(p *printer) {
+		p.types = append(p.types, types...)
+	}
+}
+
+// collectTypes merges named types of the options and the interfaces
+// the same way collectEnums merges enums.
+func (p *printer) collectTypes(ifaces []*token.Interface, declared scope) error {
+	byName := map[string]*token.Type{}
+	var types []*token.Type
+	add := func(t *token.Type) error {
+		if prev, ok := byName[t.Name]; ok {
+			if !sameTypes(prev, t) {
+				return fmt.Errorf("type %s has different definitions", t.Name)
+			}
+			return nil
+		}
+		byName[t.Name] = t
+		types = append(types, t)
+		return nil
+	}
+	for _, t := range p.types {
+		if err := add(t); err != nil {
+			return err
+		}
+	}
+	for _, iface := range ifaces {
+		for _, t := range iface.Types {
+			if err := add(t); err != nil {
+				return fmt.Errorf("%s: %s", iface.Name, err)
+			}
+		}
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+
+	for _, t := range types {
+		if err := declareTypeIdent(declared, t.Name); err != nil {
+			return fmt.Errorf("type %s: %s", t.Name, err)
+		}
+		fields := newScope()
+		for _, field := range t.Fields {
+			if err := declareTypeIdent(fields, field.Name); err != nil {
+				return fmt.Errorf("type %s field: %s", t.Name, err)
+			}
+		}
+	}
+	p.types = types
+	return nil
+}
+
+func sameTypes(a, b *token.Type) bool {
+	if a == b {
+		return true
+	}
+	if a.Sig != b.Sig || a.Type != b.Type || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		if *a.Fields[i] != *b.Fields[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+// Package rt is the runtime shared by packages generated with
+// the runtime option, it declares their common types and keeps
+// a registry, so interfaces and signals of all generated packages
+// linked into a binary are looked up in one place.
+package rt
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Names of standard methods used by generated accessors and helpers.
+const (
+	MethodPropertyGet    = "org.freedesktop.DBus.Properties.Get"
+	MethodPropertySet    = "org.freedesktop.DBus.Properties.Set"
+	MethodPropertyGetAll = "org.freedesktop.DBus.Properties.GetAll"
+	MethodPeerPing       = "org.freedesktop.DBus.Peer.Ping"
+	MethodIntrospect     = "org.freedesktop.DBus.Introspectable.Introspect"
+)
+
+// Interface is a DBus interface implementation.
+type Interface interface {
+	// Interface returns the D-Bus interface name.
+	Interface() string
+}
+
+// Signal is a common interface for all signals.
+type Signal interface {
+	Name() string
+	Interface() string
+	Sender() string
+	Path() dbus.ObjectPath
+}
+
+// InterfaceFunc creates an interface implementation for the object.
+type InterfaceFunc func(object dbus.BusObject) Interface
+
+// SignalFunc converts the raw signal into typed one.
+type SignalFunc func(signal *dbus.Signal) Signal
+
+var (
+	mu      sync.RWMutex
+	ifaces  = map[string]InterfaceFunc{}
+	signals = map[string]SignalFunc{}
+)
+
+// RegisterInterface registers fn for the named interface, generated packages
+// call it from init functions. When several packages implement the same
+// interface the first registration wins.
+func RegisterInterface(iface string, fn InterfaceFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := ifaces[iface]; !ok {
+		ifaces[iface] = fn
+	}
+}
+
+// RegisterSignal registers fn for the signal of the interface,
+// the same way RegisterInterface does.
+func RegisterSignal(iface, member string, fn SignalFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := signals[iface+"."+member]; !ok {
+		signals[iface+"."+member] = fn
+	}
+}
+
+// LookupInterface returns an interface for the named object
+// or nil when the interface isn't registered.
+func LookupInterface(object dbus.BusObject, iface string) Interface {
+	mu.RLock()
+	fn, ok := ifaces[iface]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fn(object)
+}
+
+// LookupSignal converts the given raw DBus signal into typed one
+// or returns nil when the signal isn't registered.
+func LookupSignal(signal *dbus.Signal) Signal {
+	mu.RLock()
+	fn, ok := signals[signal.Name]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fn(signal)
+}
+
+// AddMatchRule returns AddMatch rule for the given signal.
+func AddMatchRule(sig Signal) string {
+	return "type='signal',interface='" + sig.Interface() + "',member='" + sig.Name() + "'"
+}
+
+const hexDigits = "0123456789abcdef"
+
+// EscapePathLabel escapes the string to be used as an object path element
+// the way systemd does: bytes other than ASCII letters and non-leading digits
+// are replaced with an underscore followed by two lowercase hex digits,
+// the empty string becomes a single underscore.
+func EscapePathLabel(s string) string {
+	if s == "" {
+		return "_"
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			b = append(b, c)
+		} else {
+			b = append(b, '_', hexDigits[c>>4], hexDigits[c&15])
+		}
+	}
+	return string(b)
+}
+
+// UnescapePathLabel reverses EscapePathLabel.
+func UnescapePathLabel(s string) (string, error) {
+	if s == "_" {
+		return "", nil
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errors.New("truncated escape sequence in " + s)
+		}
+		hi, lo := unhex(s[i+1]), unhex(s[i+2])
+		if hi < 0 || lo < 0 {
+			return "", errors.New("invalid escape sequence in " + s)
+		}
+		b = append(b, byte(hi<<4|lo))
+		i += 2
+	}
+	return string(b), nil
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	default:
+		return -1
+	}
+}
+
+// FileFD returns the descriptor of the file to be sent in a D-Bus message,
+// the caller keeps owning the file that must stay open until it's sent.
+func FileFD(f *os.File) dbus.UnixFD {
+	return dbus.UnixFD(f.Fd())
+}
+
+// KeepFiles keeps the files from being closed by finalizers
+// until a message referring to their descriptors is sent.
+func KeepFiles(files ...*os.File) {
+	runtime.KeepAlive(files)
+}
+
+// NewFile wraps a received descriptor into a file the receiver owns
+// and must close, it returns nil when the descriptor is invalid.
+func NewFile(fd dbus.UnixFD) *os.File {
+	return os.NewFile(uintptr(fd), "unixfd")
+}
@@ -0,0 +1,72 @@
+package rt
+
+import (
+	"os"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type testSignal struct {
+	name string
+}
+
+func (s *testSignal) Name() string          { return s.name }
+func (s *testSignal) Interface() string     { return "com.example.Test" }
+func (s *testSignal) Sender() string        { return "" }
+func (s *testSignal) Path() dbus.ObjectPath { return "/" }
+
+func TestRegistry(t *testing.T) {
+	RegisterSignal("com.example.Test", "Changed", func(signal *dbus.Signal) Signal {
+		return &testSignal{name: "Changed"}
+	})
+	RegisterSignal("com.example.Test", "Changed", func(signal *dbus.Signal) Signal {
+		return &testSignal{name: "Overridden"}
+	})
+
+	sig := LookupSignal(&dbus.Signal{Name: "com.example.Test.Changed"})
+	if sig == nil || sig.Name() != "Changed" {
+		t.Fatalf("LookupSignal() = %v, want the first registered signal", sig)
+	}
+	if sig = LookupSignal(&dbus.Signal{Name: "com.example.Test.Unknown"}); sig != nil {
+		t.Errorf("LookupSignal() = %v, want nil for unknown signals", sig)
+	}
+	if got, want := AddMatchRule(&testSignal{name: "Changed"}),
+		"type='signal',interface='com.example.Test',member='Changed'"; got != want {
+		t.Errorf("AddMatchRule() = %q, want %q", got, want)
+	}
+	if iface := LookupInterface(nil, "com.example.Test"); iface != nil {
+		t.Errorf("LookupInterface() = %v, want nil for unknown interfaces", iface)
+	}
+}
+
+func TestPathLabel(t *testing.T) {
+	for s, want := range map[string]string{
+		"":             "_",
+		"dbus.service": "dbus_2eservice",
+		"1a-b_c":       "_31a_2db_5fc",
+		"ünit":         "_c3_bcnit",
+	} {
+		if got := EscapePathLabel(s); got != want {
+			t.Errorf("EscapePathLabel(%q) = %q, want %q", s, got, want)
+		}
+		if got, err := UnescapePathLabel(want); err != nil || got != s {
+			t.Errorf("UnescapePathLabel(%q) = %q, %v, want %q", want, got, err, s)
+		}
+	}
+	for _, s := range []string{"a_2", "a_zz"} {
+		if _, err := UnescapePathLabel(s); err == nil {
+			t.Errorf("UnescapePathLabel(%q) succeeded", s)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	f := NewFile(FileFD(os.Stdin))
+	if f == nil || f.Fd() != os.Stdin.Fd() {
+		t.Fatalf("NewFile(FileFD(os.Stdin)) = %v", f)
+	}
+	if f = NewFile(-1); f != nil {
+		t.Errorf("NewFile(-1) = %v, want nil", f)
+	}
+}
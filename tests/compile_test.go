@@ -23,6 +23,71 @@ func TestItCompiles(t *testing.T) {
 	}
 }
 
+func TestMockCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	for _, tc := range xmlFilesAndAll() {
+		files := tc
+		t.Run(strings.Join(files, "/"), func(t *testing.T) {
+			t.Parallel()
+			checkCompileMock(t, "testdata/test_it_compiles.gof", files)
+		})
+	}
+}
+
+func TestMock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	checkCompileMock(t, "testdata/test_mock.gof", []string{"testdata/org.freedesktop.DBus.xml"})
+}
+
+func TestCamelCaseCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	b := run(t, append([]string{"-package", "main", "-naming", "camel"}, xmlFiles...)...)
+	if err := compile("testdata/test_it_compiles.gof", b); err != nil {
+		t.Errorf("compile(%v) error: %s", xmlFiles, err)
+	}
+}
+
+func TestOutDirCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	run(t, append([]string{"-package", "main", "-out", dir}, xmlFiles...)...)
+	run(t, append([]string{"-package", "main", "-mock", "-out", dir}, xmlFiles...)...)
+	if err := compile("testdata/test_mock.gof", readFiles(t, dir)...); err != nil {
+		t.Errorf("compile(%v) error: %s", xmlFiles, err)
+	}
+}
+
+// readFiles returns contents of all files in the directory.
+func readFiles(t *testing.T, dir string) [][]byte {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcs := make([][]byte, 0, len(infos))
+	for _, info := range infos {
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, b)
+	}
+	return srcs
+}
+
 func TestCompile(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode")
@@ -43,20 +108,35 @@ func TestCompile(t *testing.T) {
 func checkCompile(t *testing.T, goFile string, xmlFiles []string) {
 	t.Helper()
 	b := run(t, append([]string{"-package", "main"}, xmlFiles...)...)
-	if err := compile(b, goFile); err != nil {
+	if err := compile(goFile, b); err != nil {
 		t.Errorf("compile(%q, %v) error: %s", goFile, xmlFiles, err)
 	}
 }
 
-func compile(b []byte, goFile string) error {
+// checkCompileMock is checkCompile that also generates mocks into the package.
+func checkCompileMock(t *testing.T, goFile string, xmlFiles []string) {
+	t.Helper()
+	b := run(t, append([]string{"-package", "main"}, xmlFiles...)...)
+	m := run(t, append([]string{"-package", "main", "-mock"}, xmlFiles...)...)
+	if err := compile(goFile, b, m); err != nil {
+		t.Errorf("compile(%q, %v) error: %s", goFile, xmlFiles, err)
+	}
+}
+
+func compile(goFile string, srcs ...[]byte) error {
 	temp, err := ioutil.TempDir("", "")
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(temp)
 
-	if err = ioutil.WriteFile(temp+"/gen.go", b, 0644); err != nil {
-		return err
+	args := []string{"run", temp + "/main.go"}
+	for i, b := range srcs {
+		name := fmt.Sprintf("%s/gen%d.go", temp, i)
+		if err = ioutil.WriteFile(name, b, 0644); err != nil {
+			return err
+		}
+		args = append(args, name)
 	}
 	path, err := filepath.Abs(goFile)
 	if err != nil {
@@ -65,9 +145,7 @@ func compile(b []byte, goFile string) error {
 	if err = os.Symlink(path, temp+"/main.go"); err != nil {
 		return err
 	}
-	if out, err := exec.Command(
-		"go", "run", temp+"/main.go", temp+"/gen.go",
-	).CombinedOutput(); err != nil {
+	if out, err := exec.Command("go", args...).CombinedOutput(); err != nil {
 		return fmt.Errorf("compile error: %s", out)
 	}
 	return nil
@@ -0,0 +1,141 @@
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `{
+	"packages": [
+		{
+			"package": "main",
+			"inputs": [%[1]q],
+			"output": "gen.go",
+			"interfaces": {
+				"org.freedesktop.DBus": {
+					"name": "Bus",
+					"types": {
+						"RequestName.in1": "RequestNameFlags",
+						"RequestName.out0": "RequestNameReply",
+						"NameAcquired.v0": "BusName",
+						"Features": "[]Feature"
+					}
+				}
+			}
+		},
+		{
+			"package": "main",
+			"inputs": [%[1]q],
+			"output": "gen_mock.go",
+			"mock": true,
+			"interfaces": {
+				"org.freedesktop.DBus": {
+					"name": "Bus",
+					"types": {
+						"RequestName.in1": "RequestNameFlags",
+						"RequestName.out0": "RequestNameReply",
+						"NameAcquired.v0": "BusName",
+						"Features": "[]Feature"
+					}
+				}
+			}
+		}
+	]
+}`
+
+func TestConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	xmlFile, err := filepath.Abs("testdata/org.freedesktop.DBus.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(cfgFile, []byte(fmt.Sprintf(testConfig, xmlFile)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, "-config", cfgFile)
+	run(t, "-check", "-config", cfgFile)
+	if _, err = exe(t, "-config", cfgFile, "-naming", "camel"); err == nil {
+		t.Error("-config combined with -naming succeeded")
+	}
+
+	var srcs [][]byte
+	for _, name := range []string{"gen.go", "gen_mock.go"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, b)
+	}
+	if err := compile("testdata/test_config.gof", srcs...); err != nil {
+		t.Error(err)
+	}
+
+	cfg := fmt.Sprintf(`{"packages": [
+		{"package": "one", "inputs": [%[1]q], "out": "gen"},
+		{"package": "one", "inputs": [%[1]q], "out": "gen", "mock": true},
+		{"package": "two", "inputs": [%[1]q], "out": "gen/"}
+	]}`, xmlFile)
+	if err = ioutil.WriteFile(cfgFile, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exe(t, "-config", cfgFile); err == nil {
+		t.Error("packages sharing out directory succeeded")
+	}
+}
+
+func TestConfigIntrospect(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	defer serve(t, addr, "com.example.One", "com.example.A")()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.json")
+	for _, tc := range []struct {
+		options string
+		fail    bool
+	}{
+		{`"parallel": 1, "timeout": "5s", "progress": true`, false},
+		{`"parallel": 0`, true},
+		{`"timeout": "5"`, true},
+	} {
+		cfg := fmt.Sprintf(`{"packages": [{
+			"package": "main", "address": [%q], "dest": ["com.example.One"], "output": "gen.go", %s
+		}]}`, addr, tc.options)
+		if err = ioutil.WriteFile(cfgFile, []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, stderr, err := exeStderr(t, "-config", cfgFile)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("%s: succeeded", tc.options)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", tc.options, err)
+		}
+		if !bytes.Contains(stderr, []byte("com.example.One: 1 objects introspected")) {
+			t.Errorf("%s: progress is not reported:\n%s", tc.options, stderr)
+		}
+	}
+}
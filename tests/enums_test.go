@@ -0,0 +1,117 @@
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const enumsXML = `<node>
+	<interface name="com.example.Device">
+		%[1]s
+		<method name="SetState">
+			<arg name="state" type="u" direction="in"/>
+			<arg name="previous" type="u" direction="out"/>
+			%[2]s
+		</method>
+		<method name="ListCaps">
+			<arg name="caps" type="aq" direction="out"/>
+			%[3]s
+		</method>
+		<property name="State" type="u" access="read">
+			%[4]s
+		</property>
+	</interface>
+</node>`
+
+var (
+	enumsPlainXML     = fmt.Sprintf(enumsXML, "", "", "", "")
+	enumsAnnotatedXML = fmt.Sprintf(enumsXML,
+		`<annotation name="dbusgen.Enum.State" value="Off=0,On=1,Standby=2,Default=0"/>
+		<annotation name="dbusgen.Flags.Caps" value="None=0,Read=0x1,Write=0x2,ReadWrite=0x3"/>`,
+		`<annotation name="dbusgen.Enum.state" value="State"/>
+			<annotation name="dbusgen.Enum.out0" value="State"/>`,
+		`<annotation name="dbusgen.Enum.caps" value="Caps"/>`,
+		`<annotation name="dbusgen.Enum" value="State"/>`,
+	)
+)
+
+const enumsConfig = `{
+	"packages": [
+		{
+			"package": "main",
+			"inputs": [%q],
+			"output": "gen.go",
+			"enums": {
+				"State": {"values": {"Off": 0, "On": 1, "Standby": 2, "Default": 0}},
+				"Caps": {"flags": true, "values": {"None": 0, "Read": 1, "Write": 2, "ReadWrite": 3}}
+			},
+			"interfaces": {
+				"com.example.Device": {
+					"enums": {
+						"SetState.state": "State",
+						"SetState.out0": "State",
+						"ListCaps.caps": "Caps",
+						"State": "State"
+					}
+				}
+			}
+		}
+	]
+}`
+
+func TestEnums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := []string{
+		"type State uint32",
+		"StateStandby State = 2",
+		"type Caps uint16",
+		"CapsReadWrite Caps = 3",
+		"SetState(state State) (previous State, err error)",
+		"ListCaps() (caps []Caps, err error)",
+		"GetState() (state State, err error)",
+	}
+	b := run(t, writeFile(t, dir, "annotated.xml", enumsAnnotatedXML))
+	for _, s := range want {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("annotations: %q is missing", s)
+		}
+	}
+
+	plain := writeFile(t, dir, "plain.xml", enumsPlainXML)
+	b = runConfig(t, dir, fmt.Sprintf(enumsConfig, plain))
+	for _, s := range want {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("config: %q is missing", s)
+		}
+	}
+
+	checkFails(t, map[string]string{
+		"enum of string property": `<node>
+			<interface name="com.example.Device">
+				<annotation name="dbusgen.Enum.State" value="Off=0"/>
+				<property name="State" type="s" access="read">
+					<annotation name="dbusgen.Enum" value="State"/>
+				</property>
+			</interface>
+		</node>`,
+		"unknown enum": `<node>
+			<interface name="com.example.Device">
+				<property name="State" type="u" access="read">
+					<annotation name="dbusgen.Enum" value="State"/>
+				</property>
+			</interface>
+		</node>`,
+	})
+}
+
+func TestEnumsServer(t *testing.T) {
+	checkCompileServer(t, "testdata/test_enums.gof", enumsAnnotatedXML)
+}
@@ -0,0 +1,140 @@
+package integration_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const serverXML = `<node>
+	<interface name="com.example.Server">
+		<method name="Echo">
+			<arg name="text" type="s" direction="in"/>
+			<arg name="text" type="s" direction="out"/>
+		</method>
+		<method name="Split">
+			<arg name="pair" type="(si)" direction="in"/>
+			<arg type="s" direction="out"/>
+			<arg type="i" direction="out"/>
+		</method>
+		<method name="Fail"/>
+		<method name="Deny"/>
+		<property name="Version" type="u" access="read"/>
+		<signal name="Echoed">
+			<arg name="text" type="s"/>
+		</signal>
+	</interface>
+</node>`
+
+func TestFeatures(t *testing.T) {
+	file := "testdata/org.freedesktop.timedate1.xml"
+	for _, tc := range []struct {
+		features string
+		have     []string
+		missing  []string
+	}{
+		{
+			features: "types",
+			have:     []string{"InterfaceOrg_Freedesktop_Timedate1 ", "var _ = dbus.Store"},
+			missing:  []string{"func NewOrg_Freedesktop_Timedate1", "LookupSignal", "func (o *Org_Freedesktop_Timedate1) GetTimezone"},
+		},
+		{
+			features: "client",
+			have:     []string{"func NewOrg_Freedesktop_Timedate1", "func LookupInterface"},
+			missing:  []string{"LookupSignal", "func (o *Org_Freedesktop_Timedate1) GetTimezone", "var _ = dbus.Store"},
+		},
+		{
+			features: "client,properties",
+			have:     []string{"func (o *Org_Freedesktop_Timedate1) GetTimezone"},
+			missing:  []string{"func LookupSignal"},
+		},
+		{
+			features: "signals",
+			have:     []string{"func LookupSignal", "PropertiesChangedSignalBody struct"},
+			missing:  []string{"func LookupInterface"},
+		},
+		{
+			features: "server,signals",
+			have:     []string{"type Org_Freedesktop_Timedate1_Server interface", "func ExportOrg_Freedesktop_Timedate1(", "func EmitOrg_Freedesktop_DBus_Properties_PropertiesChangedSignal("},
+			missing:  []string{"func NewOrg_Freedesktop_Timedate1"},
+		},
+		{
+			features: "client,mocks",
+			have:     []string{"func NewMockOrg_Freedesktop_Timedate1", "\"sync\""},
+			missing:  []string{"func LookupSignal"},
+		},
+	} {
+		b := run(t, "-features", tc.features, file)
+		for _, s := range tc.have {
+			if !bytes.Contains(b, []byte(s)) {
+				t.Errorf("%s: %q is missing", tc.features, s)
+			}
+		}
+		for _, s := range tc.missing {
+			if bytes.Contains(b, []byte(s)) {
+				t.Errorf("%s: unexpected %q", tc.features, s)
+			}
+		}
+	}
+	if !bytes.Equal(run(t, file), run(t, "-features", "client,signals,properties", file)) {
+		t.Error("default features differ from client,signals,properties")
+	}
+	if _, err := exe(t, "-features", "client,unknown", file); err == nil {
+		t.Error("unknown feature succeeded")
+	}
+	if _, err := exe(t, "-features", "properties", file); err == nil {
+		t.Error("properties without client succeeded")
+	}
+}
+
+func TestFeaturesCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	for _, features := range []string{
+		"types", "client", "signals", "server", "client,properties,mocks",
+		"client,server,signals,properties,mocks",
+	} {
+		b := run(t, append([]string{"-package", "main", "-features", features}, xmlFiles...)...)
+		if err := compile("testdata/test_it_compiles.gof", b); err != nil {
+			t.Errorf("compile(%s) error: %s", features, err)
+		}
+
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		run(t, append([]string{"-package", "main", "-features", features, "-out", dir}, xmlFiles...)...)
+		err = compile("testdata/test_it_compiles.gof", readFiles(t, dir)...)
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("compile(%s, -out) error: %s", features, err)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "com.example.Server.xml")
+	if err = ioutil.WriteFile(file, []byte(serverXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("DBUSGEN_TEST_ADDRESS", addr)
+	defer os.Unsetenv("DBUSGEN_TEST_ADDRESS")
+	b := run(t, "-package", "main", "-features", "client,server,signals", file)
+	if err = compile("testdata/test_server.gof", b); err != nil {
+		t.Errorf("compile error: %s", err)
+	}
+}
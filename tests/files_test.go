@@ -0,0 +1,103 @@
+package integration_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const filesXML = `<node>
+	<interface name="com.example.Files">
+		<method name="Open">
+			<arg name="name" type="s" direction="in"/>
+			<arg name="file" type="h" direction="out"/>
+		</method>
+		<method name="Read">
+			<arg name="file" type="h" direction="in"/>
+			<arg name="data" type="s" direction="out"/>
+		</method>
+		<signal name="Opened">
+			<arg name="file" type="h"/>
+		</signal>
+		<property name="Handle" type="h" access="read"/>
+	</interface>
+</node>`
+
+// filesRefsXML has a method returning both a file and a reference.
+const filesRefsXML = `<node>
+	<interface name="com.example.Session">
+		<method name="Take">
+			<arg name="dev" type="o" direction="out"/>
+			<arg name="fd" type="h" direction="out"/>
+			<annotation name="dbusgen.Ref.dev" value="com.example.Device"/>
+		</method>
+	</interface>
+	<interface name="com.example.Device"/>
+</node>`
+
+func TestFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "com.example.Files.xml")
+	if err = ioutil.WriteFile(file, []byte(filesXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b := run(t, file); bytes.Contains(b, []byte("*os.File")) {
+		t.Error("files are generated without -files")
+	}
+
+	b := run(t, "-package", "main", "-files", "-features", "client,server,signals,properties,mocks", file)
+	for _, s := range []string{
+		"Open(name string) (file *os.File, err error)",
+		"Open(name string) (file dbus.UnixFD, err error)",
+		"Read(file *os.File) (data string, err error)",
+		"keepFiles(file)",
+		"keepFiles(body.File)",
+		"File *os.File",
+		"GetHandle() (handle dbus.UnixFD, err error)",
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is missing", s)
+		}
+	}
+
+	os.Setenv("DBUSGEN_TEST_ADDRESS", addr)
+	defer os.Unsetenv("DBUSGEN_TEST_ADDRESS")
+	if err = compile("testdata/test_files.gof", b); err != nil {
+		t.Errorf("compile error: %s", err)
+	}
+}
+
+func TestFilesRefs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "com.example.Session.xml")
+	if err = ioutil.WriteFile(file, []byte(filesRefsXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := run(t, "-package", "main", "-files", file)
+	if s := "TakeProxy(conn Conn) (dev *Com_Example_Device, fd *os.File, err error)"; !bytes.Contains(b, []byte(s)) {
+		t.Errorf("%q is missing", s)
+	}
+	if err = compile("testdata/test_it_compiles.gof", b); err != nil {
+		t.Errorf("compile error: %s", err)
+	}
+}
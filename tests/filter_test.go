@@ -0,0 +1,89 @@
+package integration_test
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOnlyPatterns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	xmlFile := "testdata/org.freedesktop.systemd1.xml"
+	for _, tc := range []struct {
+		flag    string
+		include []string
+		exclude []string
+	}{
+		{
+			"-only=org.freedesktop.systemd1.*",
+			[]string{"org.freedesktop.systemd1.Manager", "org.freedesktop.systemd1.Unit"},
+			[]string{"org.freedesktop.DBus.Peer"},
+		},
+		{
+			"-only=org.freedesktop.*,org.freedesktop.DBus.Peer",
+			[]string{"org.freedesktop.DBus.Peer"},
+			[]string{"org.freedesktop.systemd1.Manager", "org.freedesktop.DBus.Properties"},
+		},
+		{
+			"-only=org.**.Peer,*.*.*.Unit",
+			[]string{"org.freedesktop.DBus.Peer", "org.freedesktop.systemd1.Unit"},
+			[]string{"org.freedesktop.systemd1.Manager"},
+		},
+		{
+			"-except=org.freedesktop.DBus.*",
+			[]string{"org.freedesktop.systemd1.Manager"},
+			[]string{"org.freedesktop.DBus.Peer", "org.freedesktop.DBus.Properties"},
+		},
+	} {
+		b := run(t, tc.flag, xmlFile)
+		for _, name := range tc.include {
+			if !bytes.Contains(b, []byte("// "+name+"\n")) {
+				t.Errorf("%s: %s is not generated", tc.flag, name)
+			}
+		}
+		for _, name := range tc.exclude {
+			if bytes.Contains(b, []byte("// "+name+"\n")) {
+				t.Errorf("%s: %s is generated", tc.flag, name)
+			}
+		}
+	}
+}
+
+func TestMemberFilters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	argv := []string{
+		"-package=main",
+		"-only=org.freedesktop.systemd1.Manager,org.freedesktop.systemd1.Unit,org.freedesktop.systemd1.Service",
+		"-only-members=org.freedesktop.systemd1.Manager.StartUnit,signal:*.*.*.Manager.Job*,property:*.*.*.Unit.Id",
+		"-except-members=org.freedesktop.systemd1.Service.*",
+		"testdata/org.freedesktop.systemd1.xml",
+	}
+	b := run(t, argv...)
+	for _, s := range []string{
+		") StartUnit(",
+		" Org_Freedesktop_Systemd1_Manager_JobNewSignal struct",
+		") GetID(",
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is not generated", s)
+		}
+	}
+	for _, s := range []string{
+		") StopUnit(",
+		" Org_Freedesktop_Systemd1_Manager_ReloadingSignal struct",
+		") GetDescription(",
+		") Ref(",
+		") GetType(",
+	} {
+		if bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is generated", s)
+		}
+	}
+	m := run(t, append([]string{"-mock"}, argv...)...)
+	if err := compile("testdata/test_it_compiles.gof", b, m); err != nil {
+		t.Errorf("compile error: %s", err)
+	}
+}
@@ -1,10 +1,12 @@
 package integration_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"testing"
 )
@@ -50,10 +52,27 @@ func xmlFilesAndAll() [][]string {
 	return append(all, xmlFiles)
 }
 
-// run runs the package binary with the given args.
+// run runs the package binary with the given args and fails the test on errors.
+func run(t *testing.T, argv ...string) []byte {
+	t.Helper()
+	b, err := exe(t, argv...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// exe runs the package binary with the given args.
 // It compiles the package to a temporary file for possible further reuse,
 // since `go run` takes much time for linking each time, TestMain cleans it up.
-func run(t *testing.T, argv ...string) []byte {
+func exe(t *testing.T, argv ...string) ([]byte, error) {
+	t.Helper()
+	b, _, err := exeStderr(t, argv...)
+	return b, err
+}
+
+// exeStderr is exe that also returns what the binary writes to stderr.
+func exeStderr(t *testing.T, argv ...string) ([]byte, []byte, error) {
 	t.Helper()
 	binaryMu.Lock()
 	if binaryFile == "" {
@@ -65,11 +84,14 @@ func run(t *testing.T, argv ...string) []byte {
 	}
 	binaryMu.Unlock()
 
-	b, err := exec.Command(binaryFile, argv...).CombinedOutput()
+	var stderr bytes.Buffer
+	cmd := exec.Command(binaryFile, argv...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
 	if err != nil {
-		t.Fatalf("generate error: %s, output: %s", err, string(b))
+		return nil, nil, fmt.Errorf("generate error: %s, output: %s", err, stderr.String())
 	}
-	return b
+	return b, stderr.Bytes(), nil
 }
 
 func build() (string, error) {
@@ -88,3 +110,66 @@ func build() (string, error) {
 	}
 	return f.Name(), nil
 }
+
+// writeFile writes the content to the named file in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// runConfig writes the config to dir, generates packages it describes
+// and returns gen.go of dir, the output file of the config's package.
+func runConfig(t *testing.T, dir, config string) []byte {
+	t.Helper()
+	run(t, "-config", writeFile(t, dir, "config.json", config))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// checkCompileServer generates client and server code of the document
+// and runs goFile with it against a private bus, that goFile finds
+// in DBUSGEN_TEST_ADDRESS environment variable.
+func checkCompileServer(t *testing.T, goFile, doc string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DBUSGEN_TEST_ADDRESS", addr)
+	defer os.Unsetenv("DBUSGEN_TEST_ADDRESS")
+	b := run(t, "-package", "main", "-features", "client,server", writeFile(t, dir, "doc.xml", doc))
+	if err = compile(goFile, b); err != nil {
+		t.Errorf("compile error: %s", err)
+	}
+}
+
+// checkFails checks that generation fails for every document of the cases,
+// which are mapped by what makes them invalid.
+func checkFails(t *testing.T, cases map[string]string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for what, doc := range cases {
+		if _, err = exe(t, writeFile(t, dir, "bad.xml", doc)); err == nil {
+			t.Errorf("%s succeeded", what)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package integration_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// introspectable serves the given introspection document.
+type introspectable string
+
+func (s introspectable) Introspect() (string, *dbus.Error) {
+	return string(s), nil
+}
+
+// deniedIntrospectable fails to introspect like objects protected by policies.
+type deniedIntrospectable struct{}
+
+func (deniedIntrospectable) Introspect() (string, *dbus.Error) {
+	return "", dbus.NewError("org.freedesktop.DBus.Error.AccessDenied", []interface{}{"denied"})
+}
+
+// node returns an introspection document with the interface and children.
+func node(iface string, children ...string) introspectable {
+	var s strings.Builder
+	s.WriteString("<node>")
+	if iface != "" {
+		s.WriteString(`<interface name="` + iface + `"><method name="Do"/></interface>`)
+	}
+	for _, child := range children {
+		s.WriteString(`<node name="` + child + `"/>`)
+	}
+	s.WriteString("</node>")
+	return introspectable(s.String())
+}
+
+// exportTree exports a test object tree on the session bus
+// and returns the connection's unique name to introspect.
+func exportTree(t *testing.T) (string, func()) {
+	t.Helper()
+	conn, err := dbus.SessionBusPrivate()
+	if err == nil {
+		if err = conn.Auth(nil); err == nil {
+			err = conn.Hello()
+		}
+	}
+	if err != nil {
+		t.Skipf("session bus is not available: %s", err)
+	}
+	for path, obj := range map[dbus.ObjectPath]interface{}{
+		"/":       node("", "a", "b", "denied"),
+		"/a":      node("com.example.A", "x"),
+		"/a/x":    node("com.example.X"),
+		"/b":      node("com.example.B", "y1", "y2"),
+		"/b/y1":   node("com.example.Y"),
+		"/b/y2":   node("com.example.Y"),
+		"/denied": deniedIntrospectable{},
+	} {
+		if err = conn.Export(obj, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn.Names()[0], func() {
+		conn.Close()
+	}
+}
+
+func TestIntrospectTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dest, cleanup := exportTree(t)
+	defer cleanup()
+
+	if _, err := exe(t, "-dest", dest); err == nil {
+		t.Error("failing child didn't fail generation")
+	}
+	for _, tc := range []struct {
+		argv   []string
+		ifaces []string
+	}{
+		{[]string{"-skip-errors"}, []string{"A", "X", "B"}},
+		{[]string{"-path-except=/denied"}, []string{"A", "X", "B"}},
+		{[]string{"-path=/a"}, []string{"A", "X"}},
+		{[]string{"-path=/a,/b", "-depth=0"}, []string{"A", "B"}},
+		{[]string{"-path-only=/a/**", "-path-except=/denied"}, []string{"X"}},
+		{[]string{"-path-except=/a/**,/denied"}, []string{"A", "B"}},
+	} {
+		b := run(t, append(tc.argv, "-dest", dest)...)
+		for _, name := range []string{"A", "B", "X"} {
+			want := false
+			for _, iface := range tc.ifaces {
+				want = want || iface == name
+			}
+			if got := bytes.Contains(b, []byte("// com.example."+name+"\n")); got != want {
+				t.Errorf("%v: com.example.%s generated = %t, want %t", tc.argv, name, got, want)
+			}
+		}
+		if !bytes.Equal(b, run(t, append(tc.argv, "-parallel=1", "-dest", dest)...)) {
+			t.Errorf("%v: concurrent introspection output differs from sequential", tc.argv)
+		}
+	}
+}
+
+func TestXMLTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dest, cleanup := exportTree(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	argv := []string{"-dest", dest, "-path-except=/denied"}
+	xmlFile := filepath.Join(dir, "tree.xml")
+	run(t, append(argv, "-xml-tree", "-o", xmlFile)...)
+	b, err := ioutil.ReadFile(xmlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`<node name="a">`, `<node name="x">`, `<node name="y1">`, `<node name="y2">`} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("-xml-tree output doesn't contain %s", s)
+		}
+	}
+	if !bytes.Equal(withoutInput(run(t, xmlFile)), withoutInput(run(t, argv...))) {
+		t.Error("code generated from -xml-tree output differs from code generated from the destination")
+	}
+
+	run(t, append(argv, "-xml-collapse", "-o", xmlFile)...)
+	if b, err = ioutil.ReadFile(xmlFile); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`<node name="y*">`)) || bytes.Contains(b, []byte(`<node name="y1">`)) {
+		t.Errorf("-xml-collapse didn't collapse identical objects:\n%s", b)
+	}
+	if !bytes.Equal(withoutInput(run(t, xmlFile)), withoutInput(run(t, argv...))) {
+		t.Error("code generated from -xml-collapse output differs from code generated from the destination")
+	}
+}
+
+// withoutInput strips the input hash line from the generated code.
+func withoutInput(b []byte) []byte {
+	i := bytes.Index(b, []byte("// Input: "))
+	if i == -1 {
+		return b
+	}
+	return append(b[:i:i], b[i+bytes.IndexByte(b[i:], '\n')+1:]...)
+}
+
+// startBus starts a private bus daemon and returns its address.
+func startBus(t *testing.T) (string, func()) {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not available")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(addr), func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+// serve connects to the bus at addr and exports
+// a single object implementing iface under the name.
+func serve(t *testing.T, addr, name, iface string) func() {
+	t.Helper()
+	conn, err := dbus.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Export(node(iface), "/", "org.freedesktop.DBus.Introspectable"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		conn.Close()
+	}
+}
+
+func TestIntrospectBuses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr1, stop1 := startBus(t)
+	defer stop1()
+	addr2, stop2 := startBus(t)
+	defer stop2()
+	defer serve(t, addr1, "com.example.One", "com.example.A")()
+	defer serve(t, addr2, "com.example.Two", "com.example.B")()
+
+	b := run(t,
+		"-address", addr1, "-address", addr2,
+		"-dest", "com.example.One,com.example.Two",
+	)
+	for _, name := range []string{"com.example.A", "com.example.B"} {
+		if !bytes.Contains(b, []byte("// "+name+"\n")) {
+			t.Errorf("%s is not generated", name)
+		}
+	}
+	if _, err := exe(t, "-address", addr1, "-dest", "com.example.Two"); err == nil {
+		t.Error("missing destination didn't fail generation")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	defer serve(t, addr, "com.example.One", "com.example.A")()
+	defer serve(t, addr, "com.example.Two", "com.example.B")()
+	defer serve(t, addr, "org.example.Three", "com.example.C")()
+	defer serve(t, addr, "com.example.Four", "com.example.A")()
+
+	b, stderr, err := exeStderr(t, "-address", addr, "-discover", "com.example.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"com.example.A": true,
+		"com.example.B": true,
+		"com.example.C": false,
+	} {
+		if got := bytes.Contains(b, []byte("// "+name+"\n")); got != want {
+			t.Errorf("%s generated = %t, want %t", name, got, want)
+		}
+	}
+	for _, line := range []string{
+		"discovered com.example.Four: com.example.A\n",
+		"discovered com.example.One: com.example.A\n",
+		"discovered com.example.Two: com.example.B\n",
+	} {
+		if !bytes.Contains(stderr, []byte(line)) {
+			t.Errorf("%q is not reported in:\n%s", line, stderr)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	defer serve(t, addr, "com.example.One", "com.example.A")()
+	defer serve(t, addr, "com.example.Two", "com.example.A")()
+
+	for _, tc := range []struct {
+		dest    string
+		have    []string
+		missing []string
+	}{
+		{
+			dest: "com.example.One",
+			have: []string{
+				`BusNameCom_Example_One = "com.example.One"`,
+				`PathCom_Example_A = dbus.ObjectPath("/")`,
+				"func BindCom_Example_A(conn *dbus.Conn) *Com_Example_A",
+			},
+		},
+		{
+			dest: "com.example.One,com.example.Two",
+			have: []string{
+				`BusNameCom_Example_One = "com.example.One"`,
+				`BusNameCom_Example_Two = "com.example.Two"`,
+				`PathCom_Example_A = dbus.ObjectPath("/")`,
+			},
+			missing: []string{"func BindCom_Example_A"},
+		},
+	} {
+		b := run(t, "-package", "main", "-address", addr, "-dest", tc.dest)
+		for _, s := range tc.have {
+			if !bytes.Contains(b, []byte(s)) {
+				t.Errorf("%s: %q is missing", tc.dest, s)
+			}
+		}
+		for _, s := range tc.missing {
+			if bytes.Contains(b, []byte(s)) {
+				t.Errorf("%s: unexpected %q", tc.dest, s)
+			}
+		}
+		if err := compile("testdata/test_it_compiles.gof", b); err != nil {
+			t.Errorf("%s: %s", tc.dest, err)
+		}
+	}
+}
+
+func TestInferPathTemplates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	conn, err := dbus.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	for path, obj := range map[dbus.ObjectPath]introspectable{
+		"/":                                node("", "com"),
+		"/com":                             node("", "example"),
+		"/com/example":                     node("com.example.Manager", "unit", "hci0", "hci1"),
+		"/com/example/unit":                node("", "dbus_2eservice", "a_2db"),
+		"/com/example/unit/a_2db":          node("com.example.Unit"),
+		"/com/example/unit/dbus_2eservice": node("com.example.Unit"),
+		"/com/example/hci0":                node("com.example.Adapter", "dev_00_11"),
+		"/com/example/hci1":                node("com.example.Adapter", "dev_00_22"),
+		"/com/example/hci0/dev_00_11":      node("com.example.Device"),
+		"/com/example/hci1/dev_00_22":      node("com.example.Device"),
+	} {
+		if err = conn.Export(obj, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = conn.RequestName("com.example.Tree", dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	b := run(t, "-package", "main", "-address", addr, "-dest", "com.example.Tree")
+	for _, s := range []string{
+		"func BindCom_Example_Manager(conn *dbus.Conn) *Com_Example_Manager",
+		"returns the path of a com.example.Unit object, /com/example/unit/{unit:escape}.",
+		"func BindCom_Example_Unit(conn *dbus.Conn, unit string) *Com_Example_Unit",
+		"returns the path of a com.example.Adapter object, /com/example/hci{hci}.",
+		"func ParsePathCom_Example_Device(path dbus.ObjectPath) (hci string, dev string, err error)",
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is missing", s)
+		}
+	}
+	if err = compile("testdata/test_it_compiles.gof", b); err != nil {
+		t.Error(err)
+	}
+}
+
+// countingIntrospectable is introspectable that counts Introspect calls.
+type countingIntrospectable struct {
+	doc   introspectable
+	calls *int32
+}
+
+func (c countingIntrospectable) Introspect() (string, *dbus.Error) {
+	atomic.AddInt32(c.calls, 1)
+	return c.doc.Introspect()
+}
+
+// objectManager implements org.freedesktop.DBus.ObjectManager.
+type objectManager map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+
+func (m objectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	return m, nil
+}
+
+func TestObjectManager(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	defer serve(t, addr, "com.example.Managed", "com.example.Root")()
+	conn, err := dbus.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+
+	// objects aren't listed as children, so only GetManagedObjects finds them
+	var calls int32
+	managed := objectManager{}
+	for path, iface := range map[dbus.ObjectPath]string{
+		"/m/1": "com.example.Item", "/m/2": "com.example.Item", "/m/3": "com.example.Item",
+		"/m/4": "com.example.Other",
+	} {
+		managed[path] = map[string]map[string]dbus.Variant{iface: {}}
+		obj := countingIntrospectable{node(iface), &calls}
+		if err = conn.Export(obj, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = conn.Export(countingIntrospectable{node("com.example.Manager"), &calls},
+		"/m", "org.freedesktop.DBus.Introspectable"); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Export(managed, "/m", "org.freedesktop.DBus.ObjectManager"); err != nil {
+		t.Fatal(err)
+	}
+	dest := conn.Names()[0]
+
+	b := run(t, "-address", addr, "-dest", dest, "-path=/m", "-object-manager")
+	for _, name := range []string{"com.example.Manager", "com.example.Item", "com.example.Other"} {
+		if !bytes.Contains(b, []byte("// "+name+"\n")) {
+			t.Errorf("%s is not generated", name)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Introspect called %d times, want 3", calls)
+	}
+
+	// objects without ObjectManager are walked recursively
+	b = run(t, "-address", addr, "-dest", "com.example.Managed", "-object-manager")
+	if !bytes.Contains(b, []byte("// com.example.Root\n")) {
+		t.Error("com.example.Root is not generated")
+	}
+}
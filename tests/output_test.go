@@ -0,0 +1,85 @@
+package integration_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	xmlFile := "testdata/org.freedesktop.DBus.xml"
+	genFile := filepath.Join(dir, "gen.go")
+	if _, err = exe(t, "-check", "-o", genFile, xmlFile); err == nil {
+		t.Fatal("-check passed for missing file")
+	}
+	run(t, "-o", genFile, xmlFile)
+	b, err := ioutil.ReadFile(genFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, run(t, xmlFile)) {
+		t.Error("-o file differs from stdout output")
+	}
+	run(t, "-check", "-o", genFile, xmlFile)
+
+	if err = ioutil.WriteFile(genFile, append(b, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exe(t, "-check", "-o", genFile, xmlFile); err == nil {
+		t.Error("-check passed for modified file")
+	}
+}
+
+func TestOutRemovesStale(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	xmlFile := "testdata/org.freedesktop.login1.xml"
+	run(t, "-out", dir, xmlFile)
+	run(t, "-mock", "-out", dir, xmlFile)
+	run(t, "-package", "other", "-out", filepath.Join(dir, "other"), xmlFile)
+	other := filepath.Join(dir, "other.go")
+	if err = os.Rename(filepath.Join(dir, "other", "org.freedesktop.login1.session.go"), other); err != nil {
+		t.Fatal(err)
+	}
+	own := filepath.Join(dir, "own.go")
+	if err = ioutil.WriteFile(own, []byte("package dbusgen\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	only := []string{"-only", "org.freedesktop.login1.Manager", "-out", dir, xmlFile}
+	if _, err = exe(t, append([]string{"-check"}, only...)...); err == nil {
+		t.Error("-check passed with files of interfaces that are no longer generated")
+	}
+	run(t, only...)
+	run(t, append([]string{"-check"}, only...)...)
+	for name, want := range map[string]bool{
+		"common.go":                              true,
+		"org.freedesktop.login1.manager.go":      true,
+		"org.freedesktop.login1.session.go":      false,
+		"org.freedesktop.login1.session_mock.go": true,
+		"other.go":                               true,
+		"own.go":                                 true,
+	} {
+		if _, err = os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s exists = %t, want %t", name, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const pathsXML = `<node>
+	<interface name="com.example.Unit">
+		<method name="Start"/>
+	</interface>
+	<interface name="com.example.Device">
+		<method name="Connect"/>
+	</interface>
+	<interface name="com.example.Manager">
+		<method name="Reload"/>
+	</interface>
+</node>`
+
+const pathsConfig = `{
+	"packages": [
+		{
+			"package": "main",
+			"inputs": ["paths.xml"],
+			"output": "gen.go",
+			"runtime": %t,
+			"interfaces": {
+				"com.example.Unit": {"path": "/com/example/unit/{unit:escape}"},
+				"com.example.Device": {"path": "/com/example/{adapter}/dev_{address}"},
+				"com.example.Manager": {"path": "/com/example"}
+			}
+		}
+	]
+}`
+
+func TestPathTemplates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "paths.xml"), []byte(pathsXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgFile := filepath.Join(dir, "config.json")
+	for _, runtime := range []bool{false, true} {
+		if err = ioutil.WriteFile(cfgFile, []byte(fmt.Sprintf(pathsConfig, runtime)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run(t, "-config", cfgFile)
+		b, err := ioutil.ReadFile(filepath.Join(dir, "gen.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = compile("testdata/test_paths.gof", b); err != nil {
+			t.Errorf("runtime = %t: %s", runtime, err)
+		}
+	}
+
+	if err = ioutil.WriteFile(cfgFile, []byte(
+		`{"packages": [{"inputs": ["paths.xml"], "interfaces": {"com.example.Unit": {"path": "/com/{unit}/{unit}"}}}]}`,
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exe(t, "-config", cfgFile); err == nil {
+		t.Error("invalid path template succeeded")
+	}
+}
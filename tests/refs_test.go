@@ -0,0 +1,110 @@
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const refsXML = `<node>
+	<interface name="com.example.Manager">
+		<method name="GetUnit">
+			<arg name="name" type="s" direction="in"/>
+			<arg name="unit" type="o" direction="out"/>
+			%[1]s
+		</method>
+		<method name="ListUnits">
+			<arg name="units" type="ao" direction="out"/>
+			%[2]s
+		</method>
+	</interface>
+	<interface name="com.example.Unit">
+		<method name="Describe">
+			<arg name="text" type="s" direction="out"/>
+		</method>
+	</interface>
+</node>`
+
+var (
+	refsPlainXML     = fmt.Sprintf(refsXML, "", "")
+	refsAnnotatedXML = fmt.Sprintf(refsXML,
+		`<annotation name="dbusgen.Ref.unit" value="com.example.Unit"/>`,
+		`<annotation name="dbusgen.Ref.out0" value="com.example.Unit"/>`,
+	)
+)
+
+const refsConfig = `{
+	"packages": [
+		{
+			"package": "main",
+			"inputs": [%q],
+			"output": "gen.go",
+			"interfaces": {
+				"com.example.Manager": {
+					"refs": {
+						"GetUnit.unit": "com.example.Unit",
+						"ListUnits.out0": "com.example.Unit"
+					}
+				}
+			}
+		}
+	]
+}`
+
+func TestRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	annotated := writeFile(t, dir, "annotated.xml", refsAnnotatedXML)
+	b := run(t, annotated)
+	for _, s := range []string{
+		"type Conn interface",
+		"GetUnitProxy(conn Conn, name string) (unit *Com_Example_Unit, err error)",
+		"ListUnitsProxy(conn Conn) (units []*Com_Example_Unit, err error)",
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is missing", s)
+		}
+	}
+
+	// referred interfaces that aren't generated are ignored
+	if b = run(t, "-only", "com.example.Manager", annotated); bytes.Contains(b, []byte("Proxy(")) {
+		t.Error("helpers of not generated interfaces are generated")
+	}
+
+	plain := writeFile(t, dir, "plain.xml", refsPlainXML)
+	b = runConfig(t, dir, fmt.Sprintf(refsConfig, plain))
+	if !bytes.Contains(b, []byte("GetUnitProxy(")) || !bytes.Contains(b, []byte("ListUnitsProxy(")) {
+		t.Error("config refs don't generate helpers")
+	}
+
+	checkFails(t, map[string]string{
+		"reference of as argument": `<node>
+			<interface name="com.example.Manager">
+				<method name="ListNames">
+					<arg name="names" type="as" direction="out"/>
+					<annotation name="dbusgen.Ref.names" value="com.example.Unit"/>
+				</method>
+			</interface>
+			<interface name="com.example.Unit"/>
+		</node>`,
+		"reference of unknown argument": `<node>
+			<interface name="com.example.Manager">
+				<method name="GetUnit">
+					<arg name="unit" type="o" direction="out"/>
+					<annotation name="dbusgen.Ref.units" value="com.example.Unit"/>
+				</method>
+			</interface>
+			<interface name="com.example.Unit"/>
+		</node>`,
+	})
+}
+
+func TestRefsServer(t *testing.T) {
+	checkCompileServer(t, "testdata/test_refs.gof", refsAnnotatedXML)
+}
@@ -0,0 +1,42 @@
+package integration_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestRuntime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	// packages have to be inside the module to be importable,
+	// the underscore keeps them away from ./... patterns
+	dir := "_runtime"
+	defer os.RemoveAll(dir)
+	for pkg, argv := range map[string][]string{
+		"one": {"-only=org.freedesktop.DBus", "testdata/org.freedesktop.DBus.xml"},
+		"two": {"-only=org.freedesktop.systemd1.Manager", "testdata/org.freedesktop.systemd1.xml"},
+	} {
+		file := filepath.Join(dir, pkg, pkg+".go")
+		run(t, append([]string{"-runtime", "-package", pkg, "-o", file}, argv...)...)
+	}
+	if err := os.Symlink("../testdata/test_runtime.gof", filepath.Join(dir, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("go", "run", "./"+dir).CombinedOutput(); err != nil {
+		t.Errorf("run error: %s", out)
+	}
+}
+
+func TestRuntimeCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	b := run(t, append([]string{"-package", "main", "-runtime"}, xmlFiles...)...)
+	m := run(t, append([]string{"-package", "main", "-runtime", "-mock"}, xmlFiles...)...)
+	if err := compile("testdata/test_mock.gof", b, m); err != nil {
+		t.Errorf("compile(%v) error: %s", xmlFiles, err)
+	}
+}
@@ -0,0 +1,68 @@
+package integration_test
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStandard(t *testing.T) {
+	for _, tc := range []struct {
+		argv    []string
+		have    []string
+		missing []string
+	}{
+		{
+			argv:    []string{"-standard=only"},
+			have:    []string{"InterfaceOrg_Freedesktop_DBus_Peer", "InterfaceOrg_Freedesktop_DBus_ObjectManager"},
+			missing: []string{"InterfaceOrg_Freedesktop_Hostname1", "func (o *Org_Freedesktop_DBus_Peer) Ping() error"},
+		},
+		{
+			argv:    []string{"-standard=include", "testdata/org.freedesktop.hostname1.xml"},
+			have:    []string{"InterfaceOrg_Freedesktop_DBus_Properties", "func (o *Org_Freedesktop_Hostname1) GetProperties"},
+			missing: []string{"InterfaceOrg_Freedesktop_DBus_Properties2"},
+		},
+		{
+			argv:    []string{"-standard=exclude", "testdata/org.freedesktop.DBus.xml"},
+			have:    []string{"InterfaceOrg_Freedesktop_DBus_Monitoring", "func (o *Org_Freedesktop_DBus) Ping"},
+			missing: []string{"InterfaceOrg_Freedesktop_DBus_Peer", "InterfaceOrg_Freedesktop_DBus_Properties"},
+		},
+		{
+			argv:    []string{"testdata/org.freedesktop.DBus.xml"},
+			have:    []string{"InterfaceOrg_Freedesktop_DBus_Peer"},
+			missing: []string{"methodPeerPing"},
+		},
+	} {
+		b := run(t, tc.argv...)
+		for _, s := range tc.have {
+			if !bytes.Contains(b, []byte(s)) {
+				t.Errorf("%v: %q is missing", tc.argv, s)
+			}
+		}
+		for _, s := range tc.missing {
+			if bytes.Contains(b, []byte(s)) {
+				t.Errorf("%v: unexpected %q", tc.argv, s)
+			}
+		}
+	}
+
+	if _, err := exe(t, "-standard=only", "testdata/org.freedesktop.DBus.xml"); err == nil {
+		t.Error("-standard=only with arguments succeeded")
+	}
+	if _, err := exe(t, "-standard=all"); err == nil {
+		t.Error("unknown -standard value succeeded")
+	}
+}
+
+func TestStandardCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	for _, runtime := range []string{"-runtime=false", "-runtime=true"} {
+		argv := []string{"-package", "main", "-standard", "include", runtime}
+		b := run(t, append(argv, xmlFiles...)...)
+		m := run(t, append(append(argv, "-mock"), xmlFiles...)...)
+		if err := compile("testdata/test_standard.gof", b, m); err != nil {
+			t.Errorf("compile(%v) error: %s", argv, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package integration_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const telepathyXML = `<?xml version="1.0" ?>
+<node name="/Connection" xmlns:tp="http://telepathy.freedesktop.org/wiki/DbusSpec#extensions-v0">
+	<tp:enum name="Handle_Type" type="u">
+		<tp:enumvalue suffix="None" value="0"/>
+		<tp:enumvalue suffix="Contact" value="1"/>
+	</tp:enum>
+	<interface name="com.example.Connection">
+		<tp:enum name="Connection_Status" type="u">
+			<tp:enumvalue suffix="Connected" value="0">
+				<tp:docstring>The connection is alive.</tp:docstring>
+			</tp:enumvalue>
+			<tp:enumvalue suffix="Connecting" value="1"/>
+			<tp:enumvalue suffix="Disconnected" value="2"/>
+		</tp:enum>
+		<tp:flags name="Connection_Alias_Flags" value-prefix="Connection_Alias_Flag" type="u">
+			<tp:flag suffix="User_Set" value="1"/>
+		</tp:flags>
+		<tp:struct name="Channel_Info" array-name="Channel_Info_List">
+			<tp:member type="o" name="Channel"/>
+			<tp:member type="s" name="Channel_Type"/>
+			<tp:member type="u" name="Handle_Type" tp:type="Handle_Type"/>
+		</tp:struct>
+		<tp:mapping name="Handle_Identifier_Map">
+			<tp:member type="u" name="Handle" tp:type="Contact_Handle"/>
+			<tp:member type="s" name="Identifier"/>
+		</tp:mapping>
+		<method name="GetStatus">
+			<arg direction="out" type="u" tp:type="Connection_Status"/>
+		</method>
+		<method name="GetAliasFlags">
+			<arg direction="out" type="u" tp:type="Connection_Alias_Flags"/>
+		</method>
+		<method name="ListChannels">
+			<arg direction="out" type="a(osu)" tp:type="Channel_Info[]"/>
+		</method>
+		<method name="Inspect">
+			<arg direction="in" type="au" name="Handles" tp:type="Contact_Handle[]"/>
+			<arg direction="out" type="a{us}" tp:type="Handle_Identifier_Map"/>
+		</method>
+		<property name="State" type="u" tp:type="Connection_Status" access="read"/>
+	</interface>
+</node>`
+
+func TestTelepathy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	addr, stop := startBus(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "com.example.Connection.xml")
+	if err = ioutil.WriteFile(file, []byte(telepathyXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := run(t, "-package", "main", "-features", "client,server,properties", file)
+	for _, s := range []string{
+		"type ConnectionStatus uint32",
+		"ConnectionAliasFlagUserSet ConnectionAliasFlags = 1",
+		"type HandleIdentifierMap map[uint32]string",
+		"ListChannels() (out0 []ChannelInfo, err error)",
+		"Inspect(handles []uint32) (out0 HandleIdentifierMap, err error)",
+		"GetStatus() (out0 ConnectionStatus, err error)",
+		"GetState() (state ConnectionStatus, err error)",
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is missing", s)
+		}
+	}
+
+	os.Setenv("DBUSGEN_TEST_ADDRESS", addr)
+	defer os.Unsetenv("DBUSGEN_TEST_ADDRESS")
+	if err = compile("testdata/test_telepathy.gof", b); err != nil {
+		t.Errorf("compile error: %s", err)
+	}
+
+	bad := strings.Replace(telepathyXML, `type="a(osu)"`, `type="a(os)"`, 1)
+	if err = ioutil.WriteFile(file, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exe(t, file); err == nil {
+		t.Error("mismatching tp:type succeeded")
+	}
+}
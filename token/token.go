@@ -1,5 +1,11 @@
 package token
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Interface is a D-Bus interface.
 type Interface struct {
 	Name        string
@@ -7,6 +13,22 @@ type Interface struct {
 	Properties  []*Property
 	Signals     []*Signal
 	Annotations []*Annotation
+
+	// Dests and Paths are well-known bus names and object paths
+	// the interface was found at by introspection, in discovery order.
+	Dests []string
+	Paths []string
+
+	// PathTemplate is the template of paths of the interface's objects
+	// with placeholders of path element parts, like /org/example/{name},
+	// {name:escape} placeholders are escaped the way systemd does it.
+	PathTemplate string
+
+	// Enums are enums and flag sets declared along with the interface.
+	Enums []*Enum
+
+	// Types are named struct and dictionary types declared along with the interface.
+	Types []*Type
 }
 
 // Method is a D-Bus method.
@@ -33,10 +55,36 @@ type Signal struct {
 	Annotations []*Annotation
 }
 
+// Arg finds the method's argument by name or by its position
+// prefixed with in or out, like in0 or out1.
+func (m *Method) Arg(name string) *Arg {
+	if arg := findArg(m.In, "in", name); arg != nil {
+		return arg
+	}
+	return findArg(m.Out, "out", name)
+}
+
+// Arg finds the signal's argument by name or by its position prefixed with v, like v0.
+func (s *Signal) Arg(name string) *Arg {
+	return findArg(s.Args, "v", name)
+}
+
+func findArg(args []*Arg, prefix, name string) *Arg {
+	for i, arg := range args {
+		if arg.Name == name || prefix+strconv.Itoa(i) == name {
+			return arg
+		}
+	}
+	return nil
+}
+
 // Arg is an argument.
 type Arg struct {
 	Name string
 	Type string
+
+	// Ref is the interface of objects the o or ao argument refers to.
+	Ref string
 }
 
 // Annotation is a D-Bus annotation.
@@ -44,3 +92,72 @@ type Annotation struct {
 	Name  string
 	Value string
 }
+
+// Enum is a named integer type with named values, values
+// of flag sets are bits that are combined with bitwise OR.
+type Enum struct {
+	Name   string
+	Type   string // underlying Go type, taken from arguments when empty
+	Prefix string // prefix of value constant names, Name when empty
+	Flags  bool
+	Values []*EnumValue
+}
+
+// EnumValue is a named value of an enum.
+type EnumValue struct {
+	Name  string
+	Value int64
+}
+
+// Apply makes the argument, or elements of the array argument,
+// of the enum's type, the enum takes the underlying type from
+// the first argument unless it's set.
+func (e *Enum) Apply(arg *Arg) error {
+	typ, slice := arg.Type, ""
+	if strings.HasPrefix(typ, "[]") {
+		typ, slice = typ[2:], "[]"
+	}
+	switch typ {
+	case "byte", "int16", "uint16", "int32", "uint32", "int64", "uint64":
+	default:
+		return fmt.Errorf("enum %s cannot be of type %s", e.Name, arg.Type)
+	}
+	if e.Type == "" {
+		e.Type = typ
+	} else if e.Type != typ {
+		return fmt.Errorf("enum %s is of type %s, not %s", e.Name, e.Type, typ)
+	}
+	arg.Type = slice + e.Name
+	return nil
+}
+
+// Type is a named type of D-Bus structs or dictionaries,
+// structs have Fields, other types are defined by Type.
+type Type struct {
+	Name   string
+	Sig    string // D-Bus signature of values
+	Type   string // Go type definition, like map[uint32]string
+	Fields []*Arg
+}
+
+// ParseEnumValues parses comma-separated NAME=VALUE pairs of enum values,
+// values are decimal, hex with 0x prefix or octal with 0 prefix.
+func ParseEnumValues(s string) ([]*EnumValue, error) {
+	var values []*EnumValue
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, '=')
+		if i == -1 {
+			return nil, fmt.Errorf("enum value %q is not in NAME=VALUE format", pair)
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(pair[i+1:]), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("enum value %q: %s", pair, err)
+		}
+		values = append(values, &EnumValue{Name: strings.TrimSpace(pair[:i]), Value: v})
+	}
+	return values, nil
+}